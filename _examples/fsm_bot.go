@@ -2,7 +2,6 @@ package main
 
 import (
 	"github.com/pikoUsername/tgp"
-	"github.com/pikoUsername/tgp/filters"
 	"github.com/pikoUsername/tgp/fsm"
 	"github.com/pikoUsername/tgp/fsm/storage"
 )
@@ -29,7 +28,7 @@ func main() {
 	dp.MessageHandler.HandlerFunc(func(ctx *tgp.Context) {
 		ctx.Reply(tgp.NewSendMessage("And big floppa too."))
 		ctx.SetState(second_state)
-	}.Filters(filters.StateFilter(first_state, dp.Storage))
+	}.Filters(dp.StateFilter(first_state))
 
 	dp.RunPolling(tgp.NewPollingConfig(true))
 }
@@ -53,5 +53,13 @@ func main() {
 			}
 		}
 	})
+	// outer middlewares are called for every update, before filters
+	// dispatcher middlewares applies to all update types
+	dp.UseOuter(func(next tgp.HandlerFunc) tgp.HandlerFunc {
+		return func(ctx *tgp.Context) {
+			log.Println("update", ctx.Update.UpdateID)
+			next(ctx)
+		}
+	})
 	log.Fatal(dp.RunPolling(tgp.NewPollingConfig(true)))
 }
@@ -1,7 +1,9 @@
 package tgp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -47,6 +49,20 @@ type Bot struct {
 
 	// Client uses for requests
 	Client *http.Client `json:"-"`
+
+	// Retry policy for failed requests, nil disables retries
+	Retry *RetryPolicy `json:"-"`
+
+	// Limiter throttles outgoing requests, nil disables throttling
+	Limiter Limiter `json:"-"`
+
+	// MigrateChats enables resending of request to new chat id,
+	// when group is upgraded to supergroup
+	MigrateChats bool `json:"migrate_chats"`
+
+	// OnChatMigrate calls when chat migration detected,
+	// Dispatcher uses it for moving FSM data to new chat
+	OnChatMigrate func(from, to int64) `json:"-"`
 }
 
 // NewBot returns a new bot struct which need to interact with Telegram Bot API
@@ -85,14 +101,77 @@ func (bot *Bot) SetTimeout(dur time.Duration) {
 // Request to telegram servers
 // and result parses to TelegramResponse
 func (bot *Bot) Request(Method string, params url.Values) (*objects.TelegramResponse, error) {
+	return bot.RequestContext(context.Background(), Method, params)
+}
+
+// RequestContext same as Request, but request
+// will be cancelled when ctx is done
+func (bot *Bot) RequestContext(ctx context.Context, Method string, params url.Values) (*objects.TelegramResponse, error) {
+	resp, err := bot.request(ctx, Method, params)
+	if from, to, ok := bot.migrateChatID(err, params.Get("chat_id")); ok {
+		v := url.Values{}
+		for key, value := range params {
+			v[key] = value
+		}
+		v.Set("chat_id", bot.chatMigrated(from, to))
+		return bot.request(ctx, Method, v)
+	}
+	return resp, err
+}
+
+func (bot *Bot) request(ctx context.Context, Method string, params url.Values) (*objects.TelegramResponse, error) {
 	tgurl := bot.Server.ApiURL(bot.Token, Method)
+	body := params.Encode()
 
-	request, err := http.NewRequest("POST", tgurl, strings.NewReader(params.Encode()))
-	if err != nil {
-		return nil, err
+	return bot.retry(ctx, Method, true, func() (*objects.TelegramResponse, error) {
+		if err := bot.wait(ctx, Method, params.Get("chat_id")); err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequestWithContext(ctx, "POST", tgurl, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		return bot.do(request)
+	})
+}
+
+// migrateChatID returns old and new chat id, if err says that chat is migrated to supergroup
+func (bot *Bot) migrateChatID(err error, chatID string) (from, to int64, ok bool) {
+	if err == nil || !bot.MigrateChats {
+		return 0, 0, false
+	}
+	var apiErr *objects.TelegramApiError
+	if !errors.As(err, &apiErr) || apiErr.MigrateToChatID == 0 {
+		return 0, 0, false
+	}
+	from, perr := strconv.ParseInt(chatID, 10, 64)
+	if perr != nil {
+		return 0, 0, false
+	}
+	return from, apiErr.MigrateToChatID, true
+}
+
+// chatMigrated calls OnChatMigrate, before request is resent to new chat,
+// and returns new chat id
+func (bot *Bot) chatMigrated(from, to int64) string {
+	if bot.OnChatMigrate != nil {
+		bot.OnChatMigrate(from, to)
+	}
+	return strconv.FormatInt(to, 10)
+}
+
+// wait blocks until limiter allows to send request
+func (bot *Bot) wait(ctx context.Context, method string, chatID string) error {
+	if bot.Limiter == nil {
+		return nil
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return bot.Limiter.Wait(ctx, method, chatID)
+}
 
+// do sends request, and checks result of response
+func (bot *Bot) do(request *http.Request) (*objects.TelegramResponse, error) {
 	resp, err := bot.Client.Do(request)
 	if err != nil {
 		return nil, err
@@ -101,6 +180,10 @@ func (bot *Bot) Request(Method string, params url.Values) (*objects.TelegramResp
 
 	tgresp, err := responseDecode(resp.Body)
 	if err != nil {
+		// telegram could respond with non json body, when servers is down
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, objects.NewTelegramApiError(uint(resp.StatusCode), resp.Status, objects.ResponseParameters{})
+		}
 		return nil, err
 	}
 	return checkResult(tgresp)
@@ -109,8 +192,13 @@ func (bot *Bot) Request(Method string, params url.Values) (*objects.TelegramResp
 // BoolRequest call a Request, and return bool
 // in telegram api there are many methods that return the Boolean value
 func (bot *Bot) BoolRequest(method string, params url.Values) (bool, error) {
+	return bot.BoolRequestContext(context.Background(), method, params)
+}
+
+// BoolRequestContext same as BoolRequest, but with context
+func (bot *Bot) BoolRequestContext(ctx context.Context, method string, params url.Values) (bool, error) {
 	var ok bool
-	resp, err := bot.Request(method, params)
+	resp, err := bot.RequestContext(ctx, method, params)
 	if err != nil {
 		return false, err
 	}
@@ -146,21 +234,84 @@ func (bot *Bot) DownloadFile(path string, w io.Writer) error {
 
 // Upload file uploads file to telegram server
 func (b *Bot) UploadFile(method string, v map[string]string, data ...*objects.InputFile) (*objects.TelegramResponse, error) {
-	var name string
-	var err error
+	return b.UploadFileContext(context.Background(), method, v, data...)
+}
+
+// UploadFileContext same as UploadFile, but upload
+// will be cancelled when ctx is done
+//
+// If chat is migrated, and some of files can not be rewinded,
+// upload is not resent, OnChatMigrate is not called, and migrate error is returned
+func (b *Bot) UploadFileContext(ctx context.Context, method string, v map[string]string, data ...*objects.InputFile) (*objects.TelegramResponse, error) {
+	// multipart body can be built again, only if every reader can be rewinded
+	rewindable := true
+	for _, value := range data {
+		defer value.Close()
+		if value.URL == "" && value.Name == "" && value.File == nil && value.Path == "" {
+			return nil, tgpErr.New("err while uploading inputfile, file is empty")
+		}
+		if value.File != nil {
+			if _, ok := value.File.(io.Seeker); !ok {
+				rewindable = false
+			}
+		}
+	}
+	tgurl := b.Server.ApiURL(b.Token, method)
+
+	attempt := 0
+	upload := func(v map[string]string) (*objects.TelegramResponse, error) {
+		return b.retry(ctx, method, rewindable, func() (*objects.TelegramResponse, error) {
+			attempt++
+			if attempt > 1 {
+				for _, value := range data {
+					if s, ok := value.File.(io.Seeker); ok {
+						if _, err := s.Seek(0, io.SeekStart); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
 
+			if err := b.wait(ctx, method, v["chat_id"]); err != nil {
+				return nil, err
+			}
+
+			ms, err := newMultipartBody(v, data)
+			if err != nil {
+				return nil, err
+			}
+
+			req, err := http.NewRequestWithContext(ctx, "POST", tgurl, nil)
+			if err != nil {
+				return nil, err
+			}
+			ms.SetupRequest(req)
+			return b.do(req)
+		})
+	}
+
+	resp, err := upload(v)
+	if from, to, ok := b.migrateChatID(err, v["chat_id"]); ok && rewindable {
+		params := make(map[string]string, len(v))
+		for key, value := range v {
+			params[key] = value
+		}
+		params["chat_id"] = b.chatMigrated(from, to)
+		return upload(params)
+	}
+	return resp, err
+}
+
+// newMultipartBody writes fields and files to multipart reader
+func newMultipartBody(v map[string]string, data []*objects.InputFile) (*multipartreader.MultipartReader, error) {
 	ms := multipartreader.New()
-	err = ms.WriteFields(v)
+	err := ms.WriteFields(v)
 	if err != nil {
 		return nil, err
 	}
 	values := make(map[string]string)
 
 	for _, value := range data {
-		defer value.Close()
-		if value.URL == "" && value.Name == "" && value.File == nil && value.Path == "" {
-			return nil, tgpErr.New("err while uploading inputfile, file is empty")
-		}
 		if value.URL != "" && value.Name != "" {
 			values[value.Name] = value.URL
 
@@ -179,29 +330,7 @@ func (b *Bot) UploadFile(method string, v map[string]string, data ...*objects.In
 			}
 		}
 	}
-	// ms.AddValuesReader(f_v)
-	tgurl := b.Server.ApiURL(b.Token, name)
-
-	req, err := http.NewRequest("POST", tgurl+method, nil)
-	if err != nil {
-		return nil, err
-	}
-	ms.SetupRequest(req)
-	// sending request
-	resp, err := b.Client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	// closing body
-	defer resp.Body.Close()
-	tgresp, err := responseDecode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// returns response instant
-	return checkResult(tgresp)
+	return ms, nil
 }
 
 // GetMe represents telegram "getMe" method
@@ -314,6 +443,11 @@ func (bot *Bot) UnpinAllChatMessages(ChatId int64) (*objects.TelegramResponse, e
 
 // Send uses as sender for almost all stuff
 func (bot *Bot) SendMessageable(c Configurable) (*objects.Message, error) {
+	return bot.SendMessageableContext(context.Background(), c)
+}
+
+// SendMessageableContext same as SendMessageable, but with context
+func (bot *Bot) SendMessageableContext(ctx context.Context, c Configurable) (*objects.Message, error) {
 	v, err := c.values()
 	if err != nil {
 		return nil, err
@@ -322,7 +456,7 @@ func (bot *Bot) SendMessageable(c Configurable) (*objects.Message, error) {
 	if v.Get("parse_mode") == "" {
 		v.Set("parse_mode", bot.ParseMode)
 	}
-	resp, err := bot.Request(c.method(), v)
+	resp, err := bot.RequestContext(ctx, c.method(), v)
 
 	if err != nil {
 		return nil, err
@@ -334,13 +468,18 @@ func (bot *Bot) SendMessageable(c Configurable) (*objects.Message, error) {
 
 // uploadAndSend will send a Message with a new file to Telegram.
 func (bot *Bot) UploadAndSend(config FileableConf) (*objects.Message, error) {
+	return bot.UploadAndSendContext(context.Background(), config)
+}
+
+// UploadAndSendContext same as UploadAndSend, but with context
+func (bot *Bot) UploadAndSendContext(ctx context.Context, config FileableConf) (*objects.Message, error) {
 	params, err := config.params()
 	if err != nil {
 		return nil, err
 	}
 
 	method := config.method()
-	resp, err := bot.UploadFile(method, params, config.getFiles()...)
+	resp, err := bot.UploadFileContext(ctx, method, params, config.getFiles()...)
 	if err != nil {
 		return nil, err
 	}
@@ -352,11 +491,16 @@ func (bot *Bot) UploadAndSend(config FileableConf) (*objects.Message, error) {
 
 // Send ...
 func (bot *Bot) Send(config Configurable) (*objects.Message, error) {
+	return bot.SendContext(context.Background(), config)
+}
+
+// SendContext sends config, request will be cancelled when ctx is done
+func (bot *Bot) SendContext(ctx context.Context, config Configurable) (*objects.Message, error) {
 	switch c := config.(type) {
 	case FileableConf:
-		return bot.UploadAndSend(c)
+		return bot.UploadAndSendContext(ctx, c)
 	case Configurable:
-		return bot.SendMessageable(c)
+		return bot.SendMessageableContext(ctx, c)
 	}
 	return nil, tgpErr.New("config is not correct")
 }
@@ -429,6 +573,12 @@ func (bot *Bot) EditMessageLiveLocation(config *EditMessageLLConf) (*objects.Mes
 	return bot.Send(config)
 }
 
+// StopMessageLiveLocation stops updating a live location message
+// https://core.telegram.org/bots/api#stopmessagelivelocation
+func (bot *Bot) StopMessageLiveLocation(config *StopMessageLiveLocation) (*objects.Message, error) {
+	return bot.editMessage(context.Background(), config)
+}
+
 // SendMessage sends message using ChatID
 // see: https://core.telegram.org/bots/api#sendmessage
 func (bot *Bot) SendMessage(config *SendMessageConfig) (*objects.Message, error) {
@@ -461,6 +611,137 @@ func (bot *Bot) SendSticker(config *SendStickerConfig) (*objects.Message, error)
 	return bot.Send(config)
 }
 
+// =========================
+// Message editing
+// =========================
+
+// editMessage sends edit request, for inline messages
+// telegram returns True instead of Message, then returned Message is nil
+func (bot *Bot) editMessage(ctx context.Context, c Configurable) (*objects.Message, error) {
+	v, err := c.values()
+	if err != nil {
+		return nil, err
+	}
+	_, hasText := v["text"]
+	_, hasCaption := v["caption"]
+	if (hasText || hasCaption) && v.Get("parse_mode") == "" {
+		v.Set("parse_mode", bot.ParseMode)
+	}
+	resp, err := bot.RequestContext(ctx, c.method(), v)
+	if err != nil {
+		return nil, err
+	}
+	if string(resp.Result) == "true" {
+		return nil, nil
+	}
+	var msg objects.Message
+	err = json.Unmarshal(resp.Result, &msg)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// EditMessageText edits text of message
+// https://core.telegram.org/bots/api#editmessagetext
+func (bot *Bot) EditMessageText(config *EditMessageTextConfig) (*objects.Message, error) {
+	return bot.editMessage(context.Background(), config)
+}
+
+// EditMessageCaption edits caption of message
+// https://core.telegram.org/bots/api#editmessagecaption
+func (bot *Bot) EditMessageCaption(config *EditMessageCaptionConfig) (*objects.Message, error) {
+	return bot.editMessage(context.Background(), config)
+}
+
+// EditMessageMedia edits animation, audio, document, photo, or video of message
+// https://core.telegram.org/bots/api#editmessagemedia
+func (bot *Bot) EditMessageMedia(config *EditMessageMediaConfig) (*objects.Message, error) {
+	return bot.editMessage(context.Background(), config)
+}
+
+// EditMessageReplyMarkup edits only inline keyboard of message
+// https://core.telegram.org/bots/api#editmessagereplymarkup
+func (bot *Bot) EditMessageReplyMarkup(config *EditMessageReplyMarkupConfig) (*objects.Message, error) {
+	return bot.editMessage(context.Background(), config)
+}
+
+// DeleteMessage represents deleteMessage method
+// https://core.telegram.org/bots/api#deletemessage
+func (bot *Bot) DeleteMessage(chat_id int64, message_id int64) (bool, error) {
+	v := url.Values{}
+	v.Add("chat_id", strconv.FormatInt(chat_id, 10))
+	v.Add("message_id", strconv.FormatInt(message_id, 10))
+	return bot.BoolRequest("deleteMessage", v)
+}
+
+// AnswerCallbackQuery sends answer to callback query, client shows
+// answer as notification, or alert
+// https://core.telegram.org/bots/api#answercallbackquery
+func (bot *Bot) AnswerCallbackQuery(c *AnswerCallbackQueryConfig) (bool, error) {
+	v, err := c.values()
+	if err != nil {
+		return false, err
+	}
+	return bot.BoolRequest(c.method(), v)
+}
+
+// AnswerInlineQuery sends results to inline query, no more than 50 results allowed
+// https://core.telegram.org/bots/api#answerinlinequery
+func (bot *Bot) AnswerInlineQuery(c *AnswerInlineQueryConfig) (bool, error) {
+	v, err := c.values()
+	if err != nil {
+		return false, err
+	}
+	return bot.BoolRequest(c.method(), v)
+}
+
+// =========================
+// Payments
+// =========================
+
+// SendInvoice sends invoice
+// https://core.telegram.org/bots/api#sendinvoice
+func (bot *Bot) SendInvoice(config *SendInvoiceConfig) (*objects.Message, error) {
+	return bot.Send(config)
+}
+
+// CreateInvoiceLink creates link for invoice, returns created link
+// https://core.telegram.org/bots/api#createinvoicelink
+func (bot *Bot) CreateInvoiceLink(c *CreateInvoiceLinkConfig) (string, error) {
+	v, err := c.values()
+	if err != nil {
+		return "", err
+	}
+	resp, err := bot.Request(c.method(), v)
+	if err != nil {
+		return "", err
+	}
+	var link string
+	err = json.Unmarshal(resp.Result, &link)
+	return link, err
+}
+
+// AnswerShippingQuery replies to shipping query, when invoice is flexible
+// https://core.telegram.org/bots/api#answershippingquery
+func (bot *Bot) AnswerShippingQuery(c *AnswerShippingQueryConfig) (bool, error) {
+	v, err := c.values()
+	if err != nil {
+		return false, err
+	}
+	return bot.BoolRequest(c.method(), v)
+}
+
+// AnswerPreCheckoutQuery confirms order, answer must be sent within 10 seconds
+// https://core.telegram.org/bots/api#answerprecheckoutquery
+func (bot *Bot) AnswerPreCheckoutQuery(c *AnswerPreCheckoutQueryConfig) (bool, error) {
+	v, err := c.values()
+	if err != nil {
+		return false, err
+	}
+	return bot.BoolRequest(c.method(), v)
+}
+
 // =========================
 // Commands Methods
 // =========================
@@ -507,12 +788,18 @@ func (bot *Bot) DeleteWebhook(c *DeleteWebhookConfig) (*objects.TelegramResponse
 // https://core.telegram.org/bots/api#getupdates
 // Telegram will hold updates only on 24 hours
 func (bot *Bot) GetUpdates(c *GetUpdatesConfig) ([]*objects.Update, error) {
+	return bot.GetUpdatesContext(context.Background(), c)
+}
+
+// GetUpdatesContext same as GetUpdates, but long polling
+// request will be cancelled when ctx is done
+func (bot *Bot) GetUpdatesContext(ctx context.Context, c *GetUpdatesConfig) ([]*objects.Update, error) {
 	var updates []*objects.Update
 	v, err := c.values()
 	if err != nil {
 		return updates, err
 	}
-	resp, err := bot.Request(c.method(), v)
+	resp, err := bot.RequestContext(ctx, c.method(), v)
 	if err != nil {
 		return updates, err
 	}
@@ -1,12 +1,17 @@
 package tgp
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pikoUsername/tgp/objects"
 )
@@ -37,6 +42,19 @@ func getBot(t *testing.T) *Bot {
 	return b
 }
 
+// getLocalBot returns bot which sends requests to local test server
+func getLocalBot(t *testing.T, handler http.HandlerFunc) *Bot {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	b, err := NewBot("123:local", parseMode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Server = NewTelegramApiServer(ts.URL)
+	return b
+}
+
 func TestCheckToken(t *testing.T) {
 	b, err := NewBot("bla:bla", "HTML", nil)
 	if err != nil && b == nil {
@@ -151,3 +169,252 @@ func TestSetCommands(t *testing.T) {
 	}
 	t.Fatal("Command which getted from telegram, is not same as original, Original: ", cmd)
 }
+
+func TestRequestContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := b.RequestContext(ctx, "getMe", nil)
+	if err == nil {
+		t.Fatal("request is not cancelled")
+	}
+}
+
+func TestSendContext(t *testing.T) {
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot123:local/sendMessage" {
+			t.Error("unexpected path", r.URL.Path)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"text":"hi"}}`))
+	})
+
+	msg, err := b.SendContext(context.Background(), NewSendMessage("hi", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.MessageID != 1 || msg.Text != "hi" {
+		t.Fatal("wrong message decoded", msg)
+	}
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	calls := 0
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	})
+	b.Retry = NewRetryPolicy(3)
+	b.Retry.BaseDelay = time.Millisecond
+
+	ok, err := b.BoolRequest("deleteMessage", nil)
+	if err != nil || !ok {
+		t.Fatal("request is not retried", err)
+	}
+	if calls != 3 {
+		t.Fatal("wrong attempts count", calls)
+	}
+}
+
+func TestRetrySkipMethod(t *testing.T) {
+	calls := 0
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":1}}`))
+	})
+	b.Retry = NewRetryPolicy(5).Skip("sendMessage")
+
+	_, err := b.Request("sendMessage", nil)
+	if err == nil {
+		t.Fatal("error is not returned")
+	}
+	if calls != 1 {
+		t.Fatal("skipped method is retried", calls)
+	}
+}
+
+func TestMigrateChats(t *testing.T) {
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("chat_id") == "-1" {
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1001}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":-1001}}}`))
+	})
+	var from, to int64
+	b.MigrateChats = true
+	b.OnChatMigrate = func(f, t int64) { from, to = f, t }
+
+	msg, err := b.Send(NewSendMessage("hi", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Chat.ID != -1001 || from != -1 || to != -1001 {
+		t.Fatal("chat is not migrated", msg.Chat, from, to)
+	}
+}
+
+func TestMigrateChatsUpload(t *testing.T) {
+	var calls int
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		r.ParseMultipartForm(1 << 20)
+		if strings.TrimSpace(r.FormValue("chat_id")) == "-1" {
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1001}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":-1001}}}`))
+	})
+	var migrated int
+	b.MigrateChats = true
+	b.OnChatMigrate = func(f, t int64) { migrated++ }
+
+	// reader without Seek can not be sent again
+	photo := objects.NewInputFileFromReader(struct{ io.Reader }{strings.NewReader("photo")}, 5, "photo.jpg")
+	c := NewSendPhoto(photo)
+	c.ChatID = -1
+	if _, err := b.Send(c); err == nil {
+		t.Fatal("migrate error is not returned")
+	}
+	if calls != 1 || migrated != 0 {
+		t.Fatal("not rewindable upload is resent, or hook is called", calls, migrated)
+	}
+
+	calls = 0
+	c = NewSendPhoto(objects.NewInputFileFromReader(strings.NewReader("photo"), 5, "photo.jpg"))
+	c.ChatID = -1
+	if _, err := b.Send(c); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || migrated != 1 {
+		t.Fatal("upload is not resent to migrated chat", calls, migrated)
+	}
+}
+
+func TestAnswerInlineQueryPaginate(t *testing.T) {
+	var form map[string][]string
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	})
+
+	results := make([]objects.InlineQueryResult, 0, 25)
+	for i := 0; i < 25; i++ {
+		results = append(results, &objects.InlineQueryResultArticle{Title: strconv.Itoa(i)})
+	}
+	c := NewAnswerInlineQuery("1", results...).Paginate("10", 10)
+	if len(c.Results) != 10 || c.NextOffset != "20" {
+		t.Fatal("wrong page", len(c.Results), c.NextOffset)
+	}
+	if _, err := b.AnswerInlineQuery(c); err != nil {
+		t.Fatal(err)
+	}
+	if form["next_offset"][0] != "20" || form["cache_time"][0] != "300" {
+		t.Fatal("wrong parameters", form)
+	}
+
+	c = NewAnswerInlineQuery("1", results...).Paginate("20", 10)
+	if len(c.Results) != 5 || c.NextOffset != "" {
+		t.Fatal("wrong last page", len(c.Results), c.NextOffset)
+	}
+}
+
+func TestSendInvoice(t *testing.T) {
+	var path string
+	var form map[string][]string
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		path, form = r.URL.Path, r.PostForm
+		if strings.HasSuffix(path, "createInvoiceLink") {
+			w.Write([]byte(`{"ok":true,"result":"https://t.me/$invoice"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1,"type":"private"}}}`))
+	})
+	prices := []objects.LabeledPrice{{Label: "Floppa", Amount: 1000}}
+
+	c := NewSendInvoice(1, "Floppa", "Big floppa", "payload", "token", "USD", prices...)
+	c.SuggestedTipAmounts = []int{100, 200}
+	c.IsFlexible = true
+	if _, err := b.SendInvoice(c); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, "/sendInvoice") {
+		t.Fatal("wrong method", path)
+	}
+	if form["chat_id"][0] != "1" || form["prices"][0] != `[{"label":"Floppa","amount":1000}]` ||
+		form["suggested_tip_amounts"][0] != "[100,200]" || form["is_flexible"][0] != "true" {
+		t.Fatal("wrong parameters", form)
+	}
+	if _, ok := form["photo_url"]; ok {
+		t.Fatal("empty photo is sent", form)
+	}
+
+	link, err := b.CreateInvoiceLink(NewCreateInvoiceLink("Floppa", "Big floppa", "payload", "token", "USD", prices...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "https://t.me/$invoice" || form["currency"][0] != "USD" {
+		t.Fatal("wrong invoice link", link, form)
+	}
+	if _, ok := form["chat_id"]; ok {
+		t.Fatal("chat_id is sent to createInvoiceLink", form)
+	}
+}
+
+func TestAnswerPaymentQueries(t *testing.T) {
+	var path string
+	var form map[string][]string
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		path, form = r.URL.Path, r.PostForm
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	})
+
+	option := objects.ShippingOption{ID: "post", Title: "Post", Prices: []objects.LabeledPrice{{Label: "Post", Amount: 100}}}
+	if _, err := b.AnswerShippingQuery(NewAnswerShippingQuery("1", option)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, "/answerShippingQuery") || form["shipping_query_id"][0] != "1" || form["ok"][0] != "true" ||
+		form["shipping_options"][0] != `[{"id":"post","title":"Post","prices":[{"label":"Post","amount":100}]}]` {
+		t.Fatal("wrong parameters", path, form)
+	}
+
+	sc := &AnswerShippingQueryConfig{ShippingQueryID: "2", ErrorMessage: "no delivery"}
+	if _, err := b.AnswerShippingQuery(sc); err != nil {
+		t.Fatal(err)
+	}
+	if form["ok"][0] != "false" || form["error_message"][0] != "no delivery" {
+		t.Fatal("wrong parameters of failed shipping", form)
+	}
+	if _, ok := form["shipping_options"]; ok {
+		t.Fatal("options are sent with error", form)
+	}
+
+	if _, err := b.AnswerPreCheckoutQuery(NewAnswerPreCheckoutQuery("3", false, "out of stock")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, "/answerPreCheckoutQuery") || form["pre_checkout_query_id"][0] != "3" ||
+		form["ok"][0] != "false" || form["error_message"][0] != "out of stock" {
+		t.Fatal("wrong parameters", path, form)
+	}
+	if _, err := b.AnswerPreCheckoutQuery(NewAnswerPreCheckoutQuery("4", true, "")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := form["error_message"]; ok {
+		t.Fatal("error message is sent with ok", form)
+	}
+}
@@ -800,11 +800,532 @@ func NewEditMessageLL(longitude float64, latit float64) *EditMessageLLConf {
 	}
 }
 
-type StopMessageLiveLocation struct {
+// AnswerCallbackQueryConfig represents answerCallbackQuery method fields
+// https://core.telegram.org/bots/api#answercallbackquery
+type AnswerCallbackQueryConfig struct {
+	CallbackQueryID string // required
+	Text            string
+	ShowAlert       bool
+	URL             string
+	CacheTime       int
+}
+
+func (acqc *AnswerCallbackQueryConfig) values() (url.Values, error) {
+	v := url.Values{}
+
+	v.Add("callback_query_id", acqc.CallbackQueryID)
+	if acqc.Text != "" {
+		v.Add("text", acqc.Text)
+	}
+	v.Add("show_alert", strconv.FormatBool(acqc.ShowAlert))
+	if acqc.URL != "" {
+		v.Add("url", acqc.URL)
+	}
+	if acqc.CacheTime != 0 {
+		v.Add("cache_time", strconv.Itoa(acqc.CacheTime))
+	}
+
+	return v, nil
+}
+
+func (acqc *AnswerCallbackQueryConfig) method() string {
+	return "answerCallbackQuery"
+}
+
+func NewAnswerCallbackQuery(callback_query_id string, text string) *AnswerCallbackQueryConfig {
+	return &AnswerCallbackQueryConfig{
+		CallbackQueryID: callback_query_id,
+		Text:            text,
+	}
+}
+
+// MaxInlineQueryResults is telegram limit of results in one answer
+const MaxInlineQueryResults = 50
+
+// AnswerInlineQueryConfig represents answerInlineQuery method fields
+// https://core.telegram.org/bots/api#answerinlinequery
+type AnswerInlineQueryConfig struct {
+	InlineQueryID     string                      // required
+	Results           []objects.InlineQueryResult // required
+	CacheTime         int
+	IsPersonal        bool
+	NextOffset        string
+	SwitchPMText      string
+	SwitchPMParameter string
+}
+
+func (aiqc *AnswerInlineQueryConfig) values() (url.Values, error) {
+	v := url.Values{}
+
+	v.Add("inline_query_id", aiqc.InlineQueryID)
+
+	results := aiqc.Results
+	if results == nil {
+		results = []objects.InlineQueryResult{}
+	}
+	bs, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	v.Add("results", BytesToString(bs))
+	v.Add("cache_time", strconv.Itoa(aiqc.CacheTime))
+	v.Add("is_personal", strconv.FormatBool(aiqc.IsPersonal))
+	if aiqc.NextOffset != "" {
+		v.Add("next_offset", aiqc.NextOffset)
+	}
+	if aiqc.SwitchPMText != "" {
+		v.Add("switch_pm_text", aiqc.SwitchPMText)
+		v.Add("switch_pm_parameter", aiqc.SwitchPMParameter)
+	}
+
+	return v, nil
+}
+
+func (aiqc *AnswerInlineQueryConfig) method() string {
+	return "answerInlineQuery"
+}
+
+// Paginate leaves in Results only one page, which starts from offset of inline query
+// and sets NextOffset, so telegram will request next page when user scrolls results
+func (aiqc *AnswerInlineQueryConfig) Paginate(offset string, pageSize int) *AnswerInlineQueryConfig {
+	if pageSize <= 0 || pageSize > MaxInlineQueryResults {
+		pageSize = MaxInlineQueryResults
+	}
+	start, err := strconv.Atoi(offset)
+	if err != nil || start < 0 {
+		start = 0
+	}
+	if start > len(aiqc.Results) {
+		start = len(aiqc.Results)
+	}
+	end := start + pageSize
+	if end < len(aiqc.Results) {
+		aiqc.NextOffset = strconv.Itoa(end)
+	} else {
+		end = len(aiqc.Results)
+		aiqc.NextOffset = ""
+	}
+	aiqc.Results = aiqc.Results[start:end]
+	return aiqc
+}
+
+// NewAnswerInlineQuery creates config with default cache time, 300 seconds
+func NewAnswerInlineQuery(inline_query_id string, results ...objects.InlineQueryResult) *AnswerInlineQueryConfig {
+	return &AnswerInlineQueryConfig{
+		InlineQueryID: inline_query_id,
+		Results:       results,
+		CacheTime:     300,
+	}
+}
+
+// BaseInvoice is fields of invoice, uses in sendInvoice and createInvoiceLink methods
+type BaseInvoice struct {
+	Title                     string                 // required
+	Description               string                 // required
+	Payload                   string                 // required
+	ProviderToken             string                 // required
+	Currency                  string                 // required
+	Prices                    []objects.LabeledPrice // required
+	MaxTipAmount              int
+	SuggestedTipAmounts       []int
+	ProviderData              string
+	PhotoURL                  string
+	PhotoSize                 int
+	PhotoWidth                int
+	PhotoHeight               int
+	NeedName                  bool
+	NeedPhoneNumber           bool
+	NeedEmail                 bool
+	NeedShippingAddress       bool
+	SendPhoneNumberToProvider bool
+	SendEmailToProvider       bool
+	IsFlexible                bool
+}
+
+// values returns url.Values representation of BaseInvoice
+func (bi *BaseInvoice) values() (url.Values, error) {
+	v := url.Values{}
+
+	v.Add("title", bi.Title)
+	v.Add("description", bi.Description)
+	v.Add("payload", bi.Payload)
+	v.Add("provider_token", bi.ProviderToken)
+	v.Add("currency", bi.Currency)
+
+	bs, err := json.Marshal(bi.Prices)
+	if err != nil {
+		return nil, err
+	}
+	v.Add("prices", BytesToString(bs))
+
+	if bi.MaxTipAmount != 0 {
+		v.Add("max_tip_amount", strconv.Itoa(bi.MaxTipAmount))
+	}
+	if len(bi.SuggestedTipAmounts) != 0 {
+		v.Add("suggested_tip_amounts", ObjectToJson(bi.SuggestedTipAmounts))
+	}
+	if bi.ProviderData != "" {
+		v.Add("provider_data", bi.ProviderData)
+	}
+	if bi.PhotoURL != "" {
+		v.Add("photo_url", bi.PhotoURL)
+		v.Add("photo_size", strconv.Itoa(bi.PhotoSize))
+		v.Add("photo_width", strconv.Itoa(bi.PhotoWidth))
+		v.Add("photo_height", strconv.Itoa(bi.PhotoHeight))
+	}
+	v.Add("need_name", strconv.FormatBool(bi.NeedName))
+	v.Add("need_phone_number", strconv.FormatBool(bi.NeedPhoneNumber))
+	v.Add("need_email", strconv.FormatBool(bi.NeedEmail))
+	v.Add("need_shipping_address", strconv.FormatBool(bi.NeedShippingAddress))
+	v.Add("send_phone_number_to_provider", strconv.FormatBool(bi.SendPhoneNumberToProvider))
+	v.Add("send_email_to_provider", strconv.FormatBool(bi.SendEmailToProvider))
+	v.Add("is_flexible", strconv.FormatBool(bi.IsFlexible))
+
+	return v, nil
+}
+
+// SendInvoiceConfig represents sendInvoice method fields
+// https://core.telegram.org/bots/api#sendinvoice
+type SendInvoiceConfig struct {
+	BaseChat
+	BaseInvoice
+	StartParameter           string
+	ProtectContent           bool
+	AllowSendingWithoutReply bool
+}
+
+func (sic *SendInvoiceConfig) values() (url.Values, error) {
+	v, _ := sic.BaseChat.values()
+
+	iv, err := sic.BaseInvoice.values()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range iv {
+		v[key] = value
+	}
+	if sic.StartParameter != "" {
+		v.Add("start_parameter", sic.StartParameter)
+	}
+	v.Add("protect_content", strconv.FormatBool(sic.ProtectContent))
+	v.Add("allow_sending_without_reply", strconv.FormatBool(sic.AllowSendingWithoutReply))
+
+	return v, nil
+}
+
+func (sic *SendInvoiceConfig) method() string {
+	return "sendInvoice"
+}
+
+func NewSendInvoice(chat_id int64, title, description, payload, provider_token, currency string, prices ...objects.LabeledPrice) *SendInvoiceConfig {
+	return &SendInvoiceConfig{
+		BaseChat: BaseChat{ChatID: chat_id},
+		BaseInvoice: BaseInvoice{
+			Title:         title,
+			Description:   description,
+			Payload:       payload,
+			ProviderToken: provider_token,
+			Currency:      currency,
+			Prices:        prices,
+		},
+	}
+}
+
+// CreateInvoiceLinkConfig represents createInvoiceLink method fields
+// https://core.telegram.org/bots/api#createinvoicelink
+type CreateInvoiceLinkConfig struct {
+	BaseInvoice
+}
+
+func (cilc *CreateInvoiceLinkConfig) method() string {
+	return "createInvoiceLink"
+}
+
+func NewCreateInvoiceLink(title, description, payload, provider_token, currency string, prices ...objects.LabeledPrice) *CreateInvoiceLinkConfig {
+	return &CreateInvoiceLinkConfig{
+		BaseInvoice: BaseInvoice{
+			Title:         title,
+			Description:   description,
+			Payload:       payload,
+			ProviderToken: provider_token,
+			Currency:      currency,
+			Prices:        prices,
+		},
+	}
+}
+
+// AnswerShippingQueryConfig represents answerShippingQuery method fields
+// if OK is false, ErrorMessage must be set up
+// https://core.telegram.org/bots/api#answershippingquery
+type AnswerShippingQueryConfig struct {
+	ShippingQueryID string // required
+	OK              bool   // required
+	ShippingOptions []objects.ShippingOption
+	ErrorMessage    string
+}
+
+func (asqc *AnswerShippingQueryConfig) values() (url.Values, error) {
+	v := url.Values{}
+
+	v.Add("shipping_query_id", asqc.ShippingQueryID)
+	v.Add("ok", strconv.FormatBool(asqc.OK))
+	if asqc.OK {
+		bs, err := json.Marshal(asqc.ShippingOptions)
+		if err != nil {
+			return nil, err
+		}
+		v.Add("shipping_options", BytesToString(bs))
+	} else {
+		v.Add("error_message", asqc.ErrorMessage)
+	}
+
+	return v, nil
+}
+
+func (asqc *AnswerShippingQueryConfig) method() string {
+	return "answerShippingQuery"
+}
+
+func NewAnswerShippingQuery(shipping_query_id string, options ...objects.ShippingOption) *AnswerShippingQueryConfig {
+	return &AnswerShippingQueryConfig{
+		ShippingQueryID: shipping_query_id,
+		OK:              true,
+		ShippingOptions: options,
+	}
+}
+
+// AnswerPreCheckoutQueryConfig represents answerPreCheckoutQuery method fields
+// if OK is false, ErrorMessage must be set up
+// https://core.telegram.org/bots/api#answerprecheckoutquery
+type AnswerPreCheckoutQueryConfig struct {
+	PreCheckoutQueryID string // required
+	OK                 bool   // required
+	ErrorMessage       string
+}
+
+func (apcqc *AnswerPreCheckoutQueryConfig) values() (url.Values, error) {
+	v := url.Values{}
+
+	v.Add("pre_checkout_query_id", apcqc.PreCheckoutQueryID)
+	v.Add("ok", strconv.FormatBool(apcqc.OK))
+	if !apcqc.OK {
+		v.Add("error_message", apcqc.ErrorMessage)
+	}
+
+	return v, nil
+}
+
+func (apcqc *AnswerPreCheckoutQueryConfig) method() string {
+	return "answerPreCheckoutQuery"
+}
+
+func NewAnswerPreCheckoutQuery(pre_checkout_query_id string, ok bool, error_message string) *AnswerPreCheckoutQueryConfig {
+	return &AnswerPreCheckoutQueryConfig{
+		PreCheckoutQueryID: pre_checkout_query_id,
+		OK:                 ok,
+		ErrorMessage:       error_message,
+	}
+}
+
+// EditConf is config of edit methods, target message
+// of config could be set up by Context.Edit method
+type EditConf interface {
+	Configurable
+	baseEdit() *BaseEdit
+}
+
+// BaseEdit uses in all edit methods, message specified by ChatID and MessageID,
+// or by InlineMessageID, if message sent via inline mode
+type BaseEdit struct {
 	ChatID          int64
+	ChannelUsername string
 	MessageID       int64
-	InlineMessageID int64
-	ReplyMarkup     objects.InlineKeyboardMarkup
+	InlineMessageID string
+	ReplyMarkup     *objects.InlineKeyboardMarkup
+}
+
+func (be *BaseEdit) baseEdit() *BaseEdit {
+	return be
+}
+
+// values returns url.Values representation of BaseEdit
+func (be *BaseEdit) values() (url.Values, error) {
+	v := url.Values{}
+
+	if be.InlineMessageID != "" {
+		v.Add("inline_message_id", be.InlineMessageID)
+	} else {
+		if be.ChannelUsername != "" {
+			v.Add("chat_id", be.ChannelUsername)
+		} else {
+			v.Add("chat_id", strconv.FormatInt(be.ChatID, 10))
+		}
+		v.Add("message_id", strconv.FormatInt(be.MessageID, 10))
+	}
+
+	if be.ReplyMarkup != nil {
+		v.Add("reply_markup", FormatMarkup(be.ReplyMarkup))
+	}
+
+	return v, nil
+}
+
+// StopMessageLiveLocation represents stopMessageLiveLocation method fields
+// https://core.telegram.org/bots/api#stopmessagelivelocation
+type StopMessageLiveLocation struct {
+	BaseEdit
+}
+
+func (smll *StopMessageLiveLocation) method() string {
+	return "stopMessageLiveLocation"
+}
+
+func NewStopMessageLiveLocation(chat_id, message_id int64) *StopMessageLiveLocation {
+	return &StopMessageLiveLocation{
+		BaseEdit: BaseEdit{
+			ChatID:    chat_id,
+			MessageID: message_id,
+		},
+	}
+}
+
+// EditMessageTextConfig represents editMessageText method fields
+// https://core.telegram.org/bots/api#editmessagetext
+type EditMessageTextConfig struct {
+	BaseEdit
+	Text                  string // required
+	ParseMode             string
+	Entities              []*objects.MessageEntity
+	DisableWebPagePreview bool
+}
+
+func (emtc *EditMessageTextConfig) values() (url.Values, error) {
+	v, _ := emtc.BaseEdit.values()
+
+	v.Add("text", emtc.Text)
+	if emtc.ParseMode != "" {
+		v.Add("parse_mode", emtc.ParseMode)
+	}
+	if emtc.Entities != nil {
+		v.Add("entities", ObjectToJson(emtc.Entities))
+	}
+	v.Add("disable_web_page_preview", strconv.FormatBool(emtc.DisableWebPagePreview))
+
+	return v, nil
+}
+
+func (emtc *EditMessageTextConfig) method() string {
+	return "editMessageText"
+}
+
+func NewEditMessageText(chat_id, message_id int64, text string) *EditMessageTextConfig {
+	return &EditMessageTextConfig{
+		BaseEdit: BaseEdit{
+			ChatID:    chat_id,
+			MessageID: message_id,
+		},
+		Text: text,
+	}
+}
+
+func NewEditInlineMessageText(inline_message_id string, text string) *EditMessageTextConfig {
+	return &EditMessageTextConfig{
+		BaseEdit: BaseEdit{
+			InlineMessageID: inline_message_id,
+		},
+		Text: text,
+	}
+}
+
+// EditMessageCaptionConfig represents editMessageCaption method fields
+// https://core.telegram.org/bots/api#editmessagecaption
+type EditMessageCaptionConfig struct {
+	BaseEdit
+	Caption         string
+	ParseMode       string
+	CaptionEntities []*objects.MessageEntity
+}
+
+func (emcc *EditMessageCaptionConfig) values() (url.Values, error) {
+	v, _ := emcc.BaseEdit.values()
+
+	v.Add("caption", emcc.Caption)
+	if emcc.ParseMode != "" {
+		v.Add("parse_mode", emcc.ParseMode)
+	}
+	if emcc.CaptionEntities != nil {
+		v.Add("caption_entities", ObjectToJson(emcc.CaptionEntities))
+	}
+
+	return v, nil
+}
+
+func (emcc *EditMessageCaptionConfig) method() string {
+	return "editMessageCaption"
+}
+
+func NewEditMessageCaption(chat_id, message_id int64, caption string) *EditMessageCaptionConfig {
+	return &EditMessageCaptionConfig{
+		BaseEdit: BaseEdit{
+			ChatID:    chat_id,
+			MessageID: message_id,
+		},
+		Caption: caption,
+	}
+}
+
+// EditMessageMediaConfig represents editMessageMedia method fields
+// Media is InputMedia object, with file_id or URL of new media
+// https://core.telegram.org/bots/api#editmessagemedia
+type EditMessageMediaConfig struct {
+	BaseEdit
+	Media interface{} // required
+}
+
+func (emmc *EditMessageMediaConfig) values() (url.Values, error) {
+	v, _ := emmc.BaseEdit.values()
+
+	bs, err := json.Marshal(emmc.Media)
+	if err != nil {
+		return nil, err
+	}
+	v.Add("media", BytesToString(bs))
+
+	return v, nil
+}
+
+func (emmc *EditMessageMediaConfig) method() string {
+	return "editMessageMedia"
+}
+
+func NewEditMessageMedia(chat_id, message_id int64, media interface{}) *EditMessageMediaConfig {
+	return &EditMessageMediaConfig{
+		BaseEdit: BaseEdit{
+			ChatID:    chat_id,
+			MessageID: message_id,
+		},
+		Media: media,
+	}
+}
+
+// EditMessageReplyMarkupConfig represents editMessageReplyMarkup method fields
+// https://core.telegram.org/bots/api#editmessagereplymarkup
+type EditMessageReplyMarkupConfig struct {
+	BaseEdit
+}
+
+func (emrmc *EditMessageReplyMarkupConfig) method() string {
+	return "editMessageReplyMarkup"
+}
+
+func NewEditMessageReplyMarkup(chat_id, message_id int64, markup *objects.InlineKeyboardMarkup) *EditMessageReplyMarkupConfig {
+	return &EditMessageReplyMarkupConfig{
+		BaseEdit: BaseEdit{
+			ChatID:      chat_id,
+			MessageID:   message_id,
+			ReplyMarkup: markup,
+		},
+	}
 }
 
 // GetUpdate method fields
@@ -1,13 +1,16 @@
 package tgp
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/pikoUsername/tgp/filters"
 	"github.com/pikoUsername/tgp/fsm"
 	"github.com/pikoUsername/tgp/fsm/storage"
 	"github.com/pikoUsername/tgp/objects"
@@ -18,6 +21,12 @@ const (
 	AcceptIndex
 )
 
+var (
+	ErrorStateNotDeclared    = tgpErr.New("current state is not declared by fsm.StatesGroup")
+	ErrorTimeoutNotSupported = tgpErr.New("storage does not support timeouts of states")
+	ErrorNoStorageKey        = tgpErr.New("update has not chat, or user for FSM storage key")
+)
+
 // Context object used in middlewares, handlers
 // middlewares can write some data for interact with handler
 // p.s idea taken from gin sources
@@ -28,17 +37,52 @@ type Context struct {
 	Storage  storage.Storage
 	Markdown Markdown
 
+	// ctx is handler context, all outgoing requests
+	// made with Context will be cancelled together with it
+	ctx context.Context
+
 	data     map[string]interface{}
 	index    int
 	cursor   int
 	handlers []*HandlerType
 
+	// handled is true, when one of handlers is matched
+	handled bool
+	// middlewares of routers, which update is propagated through
+	middlewares []MiddlewareFunc
+
 	calledErrors []error
 	mu           sync.Mutex
 
+	// scenes registered in dispatcher
+	scenes map[string]*Scene
+	// keyStrategy is Dispatcher.KeyStrategy
+	keyStrategy fsm.KeyStrategy
+	// dataLocks serializes UpdateData of same storage key,
+	// it is shared by contexts of dispatcher
+	dataLocks *keyMutex
+
 	hasDone chan struct{}
 }
 
+// Context returns context.Context of current handler,
+// use it for own requests, which must be cancelled with handler
+func (ctx *Context) Context() context.Context {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.ctx == nil {
+		return context.Background()
+	}
+	return ctx.ctx
+}
+
+// WithContext replaces handler context
+func (ctx *Context) WithContext(c context.Context) {
+	ctx.mu.Lock()
+	ctx.ctx = c
+	ctx.mu.Unlock()
+}
+
 // Context.Set just set ctxVar to key in data context
 func (ctx *Context) Set(key string, contextVar interface{}) {
 	ctx.mu.Lock()
@@ -52,6 +96,14 @@ func (ctx *Context) Get(key string) (v interface{}, ok bool) {
 	return
 }
 
+// CallbackValues returns callback data, which is parsed by
+// filters.CallbackDataFilter of handler, nil if handler has not this filter
+func (ctx *Context) CallbackValues() filters.CallbackValues {
+	v, _ := ctx.Get(filters.CallbackValuesKey)
+	values, _ := v.(filters.CallbackValues)
+	return values
+}
+
 // MustGet Same as Get, but dont checks a existing,
 // instead call Fatal method
 func (ctx *Context) MustGet(key string) (v interface{}) {
@@ -79,7 +131,7 @@ func (ctx *Context) Next() {
 }
 
 func (ctx *Context) call(hand *HandlerType) {
-	if len(hand.filters) == 0 || checkFilters(hand.filters, ctx.Update) {
+	if len(hand.filters) == 0 || checkFilters(hand.filters, ctx) {
 		hand.GetHandler()(ctx)
 		ctx.hasDone <- struct{}{}
 	}
@@ -158,7 +210,7 @@ func (ctx *Context) IsMessageToMe(message *objects.Message) bool {
 // Sends message request, which must return Message object.
 // if request type is not correct, will return error
 func (ctx *Context) Send(config Configurable) (*objects.Message, error) {
-	return ctx.Bot.Send(config)
+	return ctx.Bot.SendContext(ctx.Context(), config)
 }
 
 // Reply to this context object
@@ -170,6 +222,8 @@ func (ctx *Context) Reply(config Configurable) (*objects.Message, error) {
 		chat = upd.EditedMessage.Chat
 	} else if upd.ChannelPost != nil {
 		chat = upd.ChannelPost.Chat
+	} else if upd.EditedChannelPost != nil {
+		chat = upd.EditedChannelPost.Chat
 	} else if upd.Message != nil {
 		chat = upd.Message.Chat
 	} else {
@@ -187,7 +241,7 @@ func (ctx *Context) Reply(config Configurable) (*objects.Message, error) {
 		}
 
 		method := config.method()
-		resp, err := ctx.Bot.UploadFile(method, params, conf.getFiles()...)
+		resp, err := ctx.Bot.UploadFileContext(ctx.Context(), method, params, conf.getFiles()...)
 		if err != nil {
 			return &objects.Message{}, err
 		}
@@ -204,7 +258,7 @@ func (ctx *Context) Reply(config Configurable) (*objects.Message, error) {
 		if v.Get("parse_mode") == "" {
 			v.Set("parse_mode", ctx.Bot.ParseMode)
 		}
-		resp, err := ctx.Bot.Request(conf.method(), v)
+		resp, err := ctx.Bot.RequestContext(ctx.Context(), conf.method(), v)
 
 		if err != nil {
 			return &objects.Message{}, err
@@ -216,34 +270,306 @@ func (ctx *Context) Reply(config Configurable) (*objects.Message, error) {
 	return &objects.Message{}, tgpErr.New("config is not correct")
 }
 
+// Answer answers to callback query of this context,
+// empty text just stops client loading spinner
+func (ctx *Context) Answer(text string, showAlert bool) (bool, error) {
+	if ctx.CallbackQuery == nil {
+		return false, tgpErr.New("Update is not callback query")
+	}
+	c := NewAnswerCallbackQuery(ctx.CallbackQuery.ID, text)
+	c.ShowAlert = showAlert
+
+	v, err := c.values()
+	if err != nil {
+		return false, err
+	}
+	return ctx.Bot.BoolRequestContext(ctx.Context(), c.method(), v)
+}
+
+// AnswerInlineQuery answers to inline query of this context,
+// if config has not InlineQueryID, it will be taken from update
+func (ctx *Context) AnswerInlineQuery(c *AnswerInlineQueryConfig) (bool, error) {
+	if c.InlineQueryID == "" {
+		if ctx.InlineQuery == nil {
+			return false, tgpErr.New("Update is not inline query")
+		}
+		c.InlineQueryID = ctx.InlineQuery.Id
+	}
+	v, err := c.values()
+	if err != nil {
+		return false, err
+	}
+	return ctx.Bot.BoolRequestContext(ctx.Context(), c.method(), v)
+}
+
+// editTarget returns message of update, which can be edited
+// for callback queries it is message with button, or inline message
+func (ctx *Context) editTarget() (BaseEdit, error) {
+	var msg *objects.Message
+	upd := ctx.Update
+
+	if upd.CallbackQuery != nil {
+		if upd.CallbackQuery.InlineMessageID != "" {
+			return BaseEdit{InlineMessageID: upd.CallbackQuery.InlineMessageID}, nil
+		}
+		msg = upd.CallbackQuery.Message
+	} else if upd.ChosenInlineResult != nil && upd.ChosenInlineResult.InlineMessageID != "" {
+		return BaseEdit{InlineMessageID: upd.ChosenInlineResult.InlineMessageID}, nil
+	} else if upd.EditedMessage != nil {
+		msg = upd.EditedMessage
+	} else if upd.ChannelPost != nil {
+		msg = upd.ChannelPost
+	} else if upd.EditedChannelPost != nil {
+		msg = upd.EditedChannelPost
+	} else if upd.Message != nil {
+		msg = upd.Message
+	}
+	if msg == nil || msg.Chat == nil {
+		return BaseEdit{}, tgpErr.New("Update has not message to edit")
+	}
+	return BaseEdit{ChatID: msg.Chat.ID, MessageID: msg.MessageID}, nil
+}
+
+// Edit sends edit config, if config has not target message,
+// then message of this context will be edited
+func (ctx *Context) Edit(config EditConf) (*objects.Message, error) {
+	base := config.baseEdit()
+	if base.InlineMessageID == "" && base.MessageID == 0 {
+		target, err := ctx.editTarget()
+		if err != nil {
+			return nil, err
+		}
+		base.ChatID = target.ChatID
+		base.MessageID = target.MessageID
+		base.InlineMessageID = target.InlineMessageID
+	}
+	return ctx.Bot.editMessage(ctx.Context(), config)
+}
+
+// EditText edits text of triggering message, or callback message
+func (ctx *Context) EditText(text string, markup *objects.InlineKeyboardMarkup) (*objects.Message, error) {
+	return ctx.Edit(&EditMessageTextConfig{
+		BaseEdit: BaseEdit{ReplyMarkup: markup},
+		Text:     text,
+	})
+}
+
+// EditCaption edits caption of triggering message, or callback message
+func (ctx *Context) EditCaption(caption string, markup *objects.InlineKeyboardMarkup) (*objects.Message, error) {
+	return ctx.Edit(&EditMessageCaptionConfig{
+		BaseEdit: BaseEdit{ReplyMarkup: markup},
+		Caption:  caption,
+	})
+}
+
+// EditMedia edits media of triggering message, or callback message
+func (ctx *Context) EditMedia(media interface{}, markup *objects.InlineKeyboardMarkup) (*objects.Message, error) {
+	return ctx.Edit(&EditMessageMediaConfig{
+		BaseEdit: BaseEdit{ReplyMarkup: markup},
+		Media:    media,
+	})
+}
+
+// EditReplyMarkup edits inline keyboard of triggering message, or callback message
+// nil markup removes keyboard
+func (ctx *Context) EditReplyMarkup(markup *objects.InlineKeyboardMarkup) (*objects.Message, error) {
+	return ctx.Edit(&EditMessageReplyMarkupConfig{
+		BaseEdit: BaseEdit{ReplyMarkup: markup},
+	})
+}
+
+// Delete deletes triggering message, or callback message
+func (ctx *Context) Delete() (bool, error) {
+	target, err := ctx.editTarget()
+	if err != nil {
+		return false, err
+	}
+	if target.InlineMessageID != "" {
+		return false, tgpErr.New("inline messages can not be deleted")
+	}
+	v := url.Values{}
+	v.Add("chat_id", strconv.FormatInt(target.ChatID, 10))
+	v.Add("message_id", strconv.FormatInt(target.MessageID, 10))
+	return ctx.Bot.BoolRequestContext(ctx.Context(), "deleteMessage", v)
+}
+
+// storageKey returns FSM storage key of update, using Dispatcher.KeyStrategy
+func (ctx *Context) storageKey() (cid, uid int64, err error) {
+	cid, uid, ok := ctx.keyStrategy.Key(ctx.Update)
+	if !ok {
+		return 0, 0, ErrorNoStorageKey
+	}
+	return cid, uid, nil
+}
+
 // SetState set a state which passed for a current user in current chat
 // works only in handler, or in middleware, nor outside
+//
+// If state has timeout, storage must implement storage.Expirer,
+// after timeout state is reset, and Dispatcher.OnTimeout callbacks are called
 func (ctx *Context) SetState(state *fsm.State) error {
-	cid, uid := extractIds(ctx.Update)
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return err
+	}
+	if timeout := state.GetTimeout(); timeout > 0 {
+		e, ok := ctx.Storage.(storage.Expirer)
+		if !ok {
+			return ErrorTimeoutNotSupported
+		}
+		return e.SetStateTTL(cid, uid, state.GetFullState(), timeout)
+	}
 	return ctx.Storage.SetState(cid, uid, state.GetFullState())
 }
 
+// GetState returns state of current user in current chat,
+// if state is declared by fsm.StatesGroup, declared state is returned
 func (ctx *Context) GetState() (*fsm.State, error) {
-	var state, group string
-	cid, uid := extractIds(ctx.Update)
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return &fsm.State{}, err
+	}
 	st, err := ctx.Storage.GetState(cid, uid)
 	if err != nil {
 		return &fsm.State{}, err
 	}
-	s := strings.Split(st, ":")
-	if len(s) < 2 {
-		return &fsm.State{}, tgpErr.New("Uncorrect state string format")
+	return fsm.ParseState(st), nil
+}
+
+// NextState sets next state of group of current state,
+// if current state is last, state is reset. Returns new state
+func (ctx *Context) NextState() (*fsm.State, error) {
+	return ctx.moveState((*fsm.StatesGroup).Next)
+}
+
+// PreviousState sets previous state of group of current state,
+// if current state is first, state is reset. Returns new state
+func (ctx *Context) PreviousState() (*fsm.State, error) {
+	return ctx.moveState((*fsm.StatesGroup).Previous)
+}
+
+func (ctx *Context) moveState(move func(*fsm.StatesGroup, *fsm.State) *fsm.State) (*fsm.State, error) {
+	current, err := ctx.GetState()
+	if err != nil {
+		return nil, err
+	}
+	group := current.StatesGroup()
+	if group == nil {
+		return nil, ErrorStateNotDeclared
 	}
-	state, group = s[0], s[1]
-	return &fsm.State{State: state, GroupState: group}, nil
+	state := move(group, current)
+	if state == nil {
+		state = fsm.NewState("")
+	}
+	return state, ctx.SetState(state)
 }
 
 // ResetState reset state for current user, and current chat
 func (ctx *Context) ResetState() error {
-	cid, uid := extractIds(ctx.Update)
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return err
+	}
 	return ctx.Storage.SetState(cid, uid, fsm.DefaultState.GetFullState())
 }
 
+// ClearState deletes state and FSM data of current user in current chat,
+// scene stack is deleted too, so active scenes are left without leave hooks
+func (ctx *Context) ClearState() error {
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return err
+	}
+	return ctx.Storage.Clear(cid, uid)
+}
+
+// GetData returns FSM data of current user in current chat,
+// not to be confused with Get, which returns variables of Context
+func (ctx *Context) GetData() (storage.PackType, error) {
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ctx.Storage.GetData(cid, uid)
+	if err != nil {
+		return nil, err
+	}
+	return withoutSceneStack(data), nil
+}
+
+// SetData replaces FSM data of current user in current chat,
+// scene stack is kept
+func (ctx *Context) SetData(data storage.PackType) error {
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return err
+	}
+	if len(ctx.scenes) > 0 {
+		stored, err := ctx.Storage.GetData(cid, uid)
+		if err != nil {
+			return err
+		}
+		if stack, ok := stored[sceneStackKey]; ok {
+			data = withSceneStack(data, stack)
+		}
+	}
+	return ctx.Storage.SetData(cid, uid, data)
+}
+
+// UpdateData merges data to stored FSM data, keys which are not in data are kept
+//
+// Calls of UpdateData with same storage key are serialized between contexts
+// of one dispatcher, so concurrent handlers do not overwrite fields of each other.
+// It is not atomic against SetData, or other processes, which use same storage
+func (ctx *Context) UpdateData(data storage.PackType) error {
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return err
+	}
+	if ctx.dataLocks != nil {
+		defer ctx.dataLocks.Lock(cid, uid)()
+	}
+
+	stored, err := ctx.GetData()
+	if err != nil {
+		return err
+	}
+	merged := make(storage.PackType, len(stored)+len(data))
+	for k, v := range stored {
+		merged[k] = v
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+	return ctx.SetData(merged)
+}
+
+// DecodeData decodes FSM data to v, which is pointer to struct with json tags
+//
+// ```
+// var form struct {
+//     Name string `json:"name"`
+//     Age  int    `json:"age"`
+// }
+// err := ctx.DecodeData(&form)
+// ```
+func (ctx *Context) DecodeData(v interface{}) error {
+	data, err := ctx.GetData()
+	if err != nil {
+		return err
+	}
+	return storage.Decode(data, v)
+}
+
+// UpdateDataFrom encodes v using json tags, and merges it to FSM data
+func (ctx *Context) UpdateDataFrom(v interface{}) error {
+	data, err := storage.Encode(v)
+	if err != nil {
+		return err
+	}
+	return ctx.UpdateData(data)
+}
+
 func (ctx *Context) Reset() {
 	ctx.calledErrors = ctx.calledErrors[:0]
 	ctx.data = nil
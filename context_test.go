@@ -1,11 +1,15 @@
 package tgp
 
 import (
+	"net/http"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/pikoUsername/tgp/fsm"
 	"github.com/pikoUsername/tgp/fsm/storage"
+	"github.com/pikoUsername/tgp/objects"
 )
 
 var (
@@ -51,3 +55,188 @@ func TestResetState(t *testing.T) {
 		t.Fatal("No state")
 	}
 }
+
+func TestStatesGroupTransitions(t *testing.T) {
+	ctx := GetContext(t)
+	form := fsm.NewStatesGroup("ctxform", "name", "age")
+
+	if _, err := ctx.NextState(); err != ErrorStateNotDeclared {
+		t.Fatal("next state without group", err)
+	}
+	if err := ctx.SetState(form.First()); err != nil {
+		t.Fatal(err)
+	}
+	state, err := ctx.GetState()
+	if err != nil || state != form.First() {
+		t.Fatal("state is not reconstructed", state, err)
+	}
+	if state, _ = ctx.NextState(); state != form.State("age") {
+		t.Fatal("wrong next state", state)
+	}
+	if state, _ = ctx.PreviousState(); state != form.First() {
+		t.Fatal("wrong previous state", state)
+	}
+	ctx.SetState(form.Last())
+	ctx.NextState()
+	if state, _ = ctx.GetState(); *state != *fsm.DefaultState {
+		t.Fatal("state is not reset after last state", state)
+	}
+}
+
+func TestContextData(t *testing.T) {
+	ctx := GetContext(t)
+	type form struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	if err := ctx.UpdateData(storage.PackType{"name": "piko"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.UpdateDataFrom(struct {
+		Age int `json:"age"`
+	}{17}); err != nil {
+		t.Fatal(err)
+	}
+	var f form
+	if err := ctx.DecodeData(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "piko" || f.Age != 17 {
+		t.Fatal("data is not merged", f)
+	}
+
+	ctx.SetState(fsm.NewState("name"))
+	if err := ctx.ClearState(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ctx.GetData()
+	state, _ := ctx.GetState()
+	if data != nil || *state != *fsm.DefaultState {
+		t.Fatal("state is not cleared", data, state)
+	}
+}
+
+// slowStorage makes reads slow, so concurrent updates of data overlap
+type slowStorage struct {
+	*storage.MemoryStorage
+}
+
+func (ss *slowStorage) GetData(cid, uid int64) (storage.PackType, error) {
+	data, err := ss.MemoryStorage.GetData(cid, uid)
+	time.Sleep(time.Millisecond)
+	return data, err
+}
+
+func TestUpdateDataConcurrent(t *testing.T) {
+	dp := NewDispatcher(&Bot{}, &slowStorage{storage.NewMemoryStorage()})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := dp.Context(fakeUpd)
+			if err := ctx.UpdateData(storage.PackType{strconv.Itoa(i): i}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, _ := dp.Context(fakeUpd).GetData()
+	if len(data) != 50 {
+		t.Fatal("fields are overwritten by concurrent updates", len(data))
+	}
+}
+
+func TestContextKeyStrategy(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &objects.User{ID: 2}
+	chat := &objects.Chat{ID: 1}
+
+	// state set by message is visible in callback query of same chat
+	ctx := dp.Context(&objects.Update{Message: &objects.Message{Chat: chat, From: user}})
+	if err := ctx.SetState(fsm.NewState("menu")); err != nil {
+		t.Fatal(err)
+	}
+	ctx = dp.Context(&objects.Update{CallbackQuery: &objects.CallbackQuery{
+		From: user, Message: &objects.Message{Chat: chat},
+	}})
+	if state, err := ctx.GetState(); err != nil || state.State != "menu" {
+		t.Fatal("wrong state of callback query", state, err)
+	}
+	if !dp.StateFilter(fsm.NewState("menu")).Check(ctx.Update) {
+		t.Fatal("state filter does not pass callback query")
+	}
+
+	ctx = dp.Context(&objects.Update{Poll: &objects.Poll{}})
+	if err := ctx.SetState(fsm.NewState("menu")); err != ErrorNoStorageKey {
+		t.Fatal("wrong error of update without key", err)
+	}
+
+	dp.KeyStrategy = fsm.ChatKey
+	ctx = dp.Context(&objects.Update{Message: &objects.Message{Chat: chat, From: &objects.User{ID: 3}}})
+	ctx.SetState(fsm.NewState("shared"))
+	ctx = dp.Context(&objects.Update{Message: &objects.Message{Chat: chat, From: user}})
+	if state, _ := ctx.GetState(); state.State != "shared" {
+		t.Fatal("state is not shared in chat", state)
+	}
+}
+
+func TestContextEditText(t *testing.T) {
+	var form map[string][]string
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	})
+	dp := NewDispatcher(b, storage.NewMemoryStorage())
+
+	ctx := dp.Context(&objects.Update{
+		CallbackQuery: &objects.CallbackQuery{
+			ID:      "1",
+			Message: fakeUpd.Message,
+		},
+	})
+	if _, err := ctx.EditText("edited", nil); err != nil {
+		t.Fatal(err)
+	}
+	if form["chat_id"][0] != "1000" || form["message_id"][0] != "1000" || form["text"][0] != "edited" {
+		t.Fatal("wrong edit target", form)
+	}
+
+	ctx = dp.Context(&objects.Update{
+		CallbackQuery: &objects.CallbackQuery{ID: "1", InlineMessageID: "inline"},
+	})
+	if _, err := ctx.EditText("edited", nil); err != nil {
+		t.Fatal(err)
+	}
+	if form["inline_message_id"][0] != "inline" || len(form["chat_id"]) != 0 {
+		t.Fatal("wrong inline edit target", form)
+	}
+}
+
+func TestContextAnswer(t *testing.T) {
+	var form map[string][]string
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	})
+	dp := NewDispatcher(b, storage.NewMemoryStorage())
+
+	ctx := dp.Context(&objects.Update{
+		CallbackQuery: &objects.CallbackQuery{ID: "42"},
+	})
+	ok, err := ctx.Answer("done", true)
+	if err != nil || !ok {
+		t.Fatal(err)
+	}
+	if form["callback_query_id"][0] != "42" || form["show_alert"][0] != "true" {
+		t.Fatal("wrong answer parameters", form)
+	}
+}
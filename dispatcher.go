@@ -13,6 +13,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/pikoUsername/tgp/filters"
+	"github.com/pikoUsername/tgp/fsm"
 	"github.com/pikoUsername/tgp/fsm/storage"
 	"github.com/pikoUsername/tgp/objects"
 )
@@ -27,52 +29,118 @@ type Logger interface {
 // Bot struct uses as API wrapper
 // Dispatcher uses as Bot starter
 // Another level of abstraction
+//
+// Dispatcher can not be run again after Shutdown,
+// because Storage is closed, and handler contexts are cancelled by it
 type Dispatcher struct {
 	Bot *Bot
 
-	// handlers
-	*AllHandlerTypes
+	// root router, all handlers and routers are registered to it
+	*Router
 
 	// Storage interface
 	Storage storage.Storage
 	logger  Logger
 
+	// KeyStrategy defines storage key of FSM state and data,
+	// by default every user has own state in every chat
+	KeyStrategy fsm.KeyStrategy
+
 	OnWebhookShutdown []OnStartAndShutdownFunc
 	OnPollingShutdown []OnStartAndShutdownFunc
 	OnWebhookStartup  []OnStartAndShutdownFunc
 	OnPollingStartup  []OnStartAndShutdownFunc
+	OnChatMigrateFunc []ChatMigrateFunc
+	OnTimeoutFunc     []TimeoutFunc
+
+	errorHandlers []*errorHandler
+
+	// registered scenes by name
+	scenes map[string]*Scene
 
-	isClose bool
 	Welcome bool
 	polling bool
 	webhook bool
 
-	closeChan   chan struct{}
+	// ShutdownTimeout is time, which Shutdown waits for handlers
+	// after SIGINT or SIGTERM, zero means no limit
+	ShutdownTimeout time.Duration
+
+	// TimeoutSweepInterval is interval of checking timeouts of states,
+	// uses if Storage implements storage.Expirer
+	TimeoutSweepInterval time.Duration
+
 	functionsWG *sync.WaitGroup
 
+	// pool processes updates in polling and webhook modes
+	pool *WorkerPool
+
+	// shutdown related fields
+	closeMu     sync.Mutex
+	closed      chan struct{}
+	cancelFetch context.CancelFunc
+	cancelSweep context.CancelFunc
+	server      *http.Server
+	receiving   sync.WaitGroup
+	// submitOffset is offset after last update, which is submitted to pool,
+	// it is committed by Shutdown
+	submitOffset int64
+	// handlersCtx is parent of handler contexts in polling and webhook modes,
+	// it is cancelled, when handlers are not finished before Shutdown deadline
+	handlersCtx    context.Context
+	cancelHandlers context.CancelFunc
+
+	// dataLocks serializes Context.UpdateData of same storage key
+	dataLocks keyMutex
+
+	// migrated chats, for avoid calling hooks twice
+	migrated  map[int64]int64
+	migrateMu sync.Mutex
+
 	Debugch chan *objects.Update
 }
 
 var (
 	ErrorTypeAssertion = tgpErr.New("impossible to do type assertion to this callback")
 	ErrorConflictModes = tgpErr.New("enabled two conflicting modes at the same time, polling and webhook")
+
+	// ErrorDispatcherClosed is returned by run methods after Shutdown
+	ErrorDispatcherClosed = tgpErr.New("dispatcher is shut down, and can not be run again")
 )
 
 type OnStartAndShutdownFunc func(dp *Dispatcher)
 
+// ChatMigrateFunc calls when group migrates to supergroup
+type ChatMigrateFunc func(dp *Dispatcher, from, to int64)
+
+// TimeoutFunc calls when state of user is expired, and is reset
+type TimeoutFunc func(dp *Dispatcher, chatID, userID int64, state *fsm.State)
+
 // NewDispathcer get a new Dispatcher with default values
 func NewDispatcher(bot *Bot, storage storage.Storage) *Dispatcher {
 	dp := &Dispatcher{
-		Bot:         bot,
-		Storage:     storage,
-		Welcome:     true,
-		functionsWG: &sync.WaitGroup{},
-		closeChan:   make(chan struct{}, 1),
-		logger:      log.New(os.Stderr, "", log.LstdFlags),
+		Bot:                  bot,
+		Storage:              storage,
+		Welcome:              true,
+		ShutdownTimeout:      10 * time.Second,
+		TimeoutSweepInterval: time.Second,
+		functionsWG:          &sync.WaitGroup{},
+		logger:               log.New(os.Stderr, "", log.LstdFlags),
+		migrated:             make(map[int64]int64),
+		scenes:               make(map[string]*Scene),
+	}
+
+	dp.Router = NewRouter("dispatcher")
+	dp.Router.scene = dp.activeScene
+	dp.handlersCtx, dp.cancelHandlers = context.WithCancel(context.Background())
+	if bot != nil && bot.OnChatMigrate == nil {
+		bot.OnChatMigrate = func(from, to int64) {
+			if err := dp.MigrateChat(from, to); err != nil {
+				dp.logger.Println(err.Error())
+			}
+		}
 	}
 
-	dp.AllHandlerTypes = newHandlerTypes()
-
 	return dp
 }
 
@@ -110,33 +178,45 @@ func callListFuncs(funcs []OnStartAndShutdownFunc, wg *sync.WaitGroup, dp *Dispa
 // Config for start polling method
 type PollingConfig struct {
 	*GetUpdatesConfig
+
+	// Context stops polling, when it is done
+	// after that RunPolling calls Shutdown and returns
 	Context      context.Context
 	SkipUpdates  bool
 	SafeExit     bool
 	ResetWebhook bool
 	ErrorSleep   time.Duration
-	Relax        time.Duration
-	Timeout      time.Duration
+	// Relax is pause between getUpdates requests, usually it is not needed
+	// because of long polling
+	Relax time.Duration
+	// Timeout is long polling timeout, uses if GetUpdatesConfig.Timeout is zero
+	Timeout time.Duration
+
+	// MaxConcurrency is count of workers, which process updates in parallel
+	MaxConcurrency int
+	// QueueSize is count of updates, which can wait in queue of one worker
+	QueueSize int
 }
 
 // returns config which filled by default values, except skip updates
 // values:
-//  Relax - 1 sec
+//  Relax - 0
 //  ResetWebhook - false
 //  Error Sleep - 0.5 second
 //  SafeExit - true
-//  Timeout - 5 seconds
+//  Timeout - 30 seconds
+//  MaxConcurrency - DefaultMaxConcurrency
+//  QueueSize - DefaultQueueSize
 func NewPollingConfig(skip_updates bool) *PollingConfig {
 	return &PollingConfig{
-		GetUpdatesConfig: &GetUpdatesConfig{
-			Timeout: 5,
-		},
-		Relax:        1 * time.Second,
-		ResetWebhook: false,
-		ErrorSleep:   500 * time.Millisecond,
-		SkipUpdates:  skip_updates,
-		SafeExit:     true,
-		Timeout:      5 * time.Second,
+		GetUpdatesConfig: &GetUpdatesConfig{},
+		ResetWebhook:     false,
+		ErrorSleep:       500 * time.Millisecond,
+		SkipUpdates:      skip_updates,
+		SafeExit:         true,
+		Timeout:          30 * time.Second,
+		MaxConcurrency:   DefaultMaxConcurrency,
+		QueueSize:        DefaultQueueSize,
 	}
 }
 
@@ -153,6 +233,10 @@ type StartWebhookConfig struct {
 	URI                string
 	DropPendingUpdates bool
 	SafeExit           bool
+
+	// MaxConcurrency and QueueSize same as in PollingConfig
+	MaxConcurrency int
+	QueueSize      int
 }
 
 // NewWebhookConfig url is webhook url, address is host address
@@ -163,6 +247,8 @@ func NewWebhookConfig(uri string, address string) *StartWebhookConfig {
 		SafeExit:           true,
 		DropPendingUpdates: false,
 		URI:                uri,
+		MaxConcurrency:     DefaultMaxConcurrency,
+		QueueSize:          DefaultQueueSize,
 	}
 }
 
@@ -183,32 +269,150 @@ func (dp *Dispatcher) ResetWebhook(check bool) error {
 
 // ProcessOneUpdate processes only one comming update
 func (dp *Dispatcher) ProcessOneUpdate(upd *objects.Update) error {
+	return dp.ProcessOneUpdateContext(context.Background(), upd)
+}
+
+// ProcessOneUpdateContext processes update with handler context derived from ctx,
+// after handler returns, all requests made using tgp.Context is cancelled
+func (dp *Dispatcher) ProcessOneUpdateContext(ctx context.Context, upd *objects.Update) error {
 	local_ctx := dp.Context(upd)
 
-	if upd.Message != nil {
-		dp.MessageHandler.Trigger(local_ctx)
-	} else if upd.CallbackQuery != nil {
-		dp.CallbackQueryHandler.Trigger(local_ctx)
-	} else if upd.ChannelPost != nil {
-		dp.ChannelPostHandler.Trigger(local_ctx)
-	} else if upd.Poll != nil {
-		dp.PollHandler.Trigger(local_ctx)
-	} else if upd.PollAnswer != nil {
-		dp.PollAnswerHandler.Trigger(local_ctx)
-	} else if upd.ChatMember != nil {
-		dp.ChatMemberHandler.Trigger(local_ctx)
-	} else if upd.MyChatMember != nil {
-		dp.MyChatMemberHandler.Trigger(local_ctx)
-	} else if upd.ChatJoinRequest != nil {
-		dp.ChatJoinRequestHandler.Trigger(local_ctx)
-	} else {
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	local_ctx.ctx = hctx
+
+	if upd.Message != nil && upd.Message.MigrateToChatID != 0 && upd.Message.Chat != nil {
+		if err := dp.MigrateChat(upd.Message.Chat.ID, upd.Message.MigrateToChatID); err != nil {
+			dp.logger.Println(err.Error())
+		}
+	}
+
+	if dp.chainFor(upd) == nil {
 		return tgpErr.New(
 			"detected not supported type of updates, seems like telegram bot api updated before this package updated")
 	}
+	dp.propagate(local_ctx)
 
+	// errors returned by handlers, or recovered panics
+	var unhandled error
+	for _, err := range local_ctx.GetErrors() {
+		if !dp.handleError(local_ctx, err) && unhandled == nil {
+			unhandled = err
+		}
+	}
+	return unhandled
+}
+
+// OnChatMigrate registers callback, which calls when group migrates to supergroup
+// migration detected by service message, or by error of request
+// when Bot.MigrateChats is enabled
+func (dp *Dispatcher) OnChatMigrate(cb ChatMigrateFunc) {
+	dp.OnChatMigrateFunc = append(dp.OnChatMigrateFunc, cb)
+}
+
+// MigrateChat moves FSM states and data from old chat to new one,
+// and calls OnChatMigrate callbacks, repeated calls for same chats are ignored
+func (dp *Dispatcher) MigrateChat(from, to int64) error {
+	// lock is held while storage migrates, so concurrent updates
+	// of old and new chats do not migrate twice
+	dp.migrateMu.Lock()
+	if dp.migrated[from] == to {
+		dp.migrateMu.Unlock()
+		return nil
+	}
+	if m, ok := dp.Storage.(storage.Migrator); ok {
+		if err := m.MigrateChat(from, to); err != nil {
+			// migration is not recorded, so it can be retried
+			dp.migrateMu.Unlock()
+			return err
+		}
+	}
+	dp.migrated[from] = to
+	dp.migrateMu.Unlock()
+
+	for _, cb := range dp.OnChatMigrateFunc {
+		cb(dp, from, to)
+	}
 	return nil
 }
 
+// OnTimeout registers callback, which calls when state of user is expired,
+// state is already reset, when callback is called
+//
+// ```
+// dp.OnTimeout(func(dp *tgp.Dispatcher, chatID, userID int64, state *fsm.State) {
+//     dp.Bot.Send(&tgp.SendMessageConfig{ChatID: chatID, Text: "Time is out"})
+// })
+// ```
+func (dp *Dispatcher) OnTimeout(cb TimeoutFunc) {
+	dp.OnTimeoutFunc = append(dp.OnTimeoutFunc, cb)
+}
+
+// SweepTimeouts resets expired states, and calls OnTimeout callbacks,
+// it is called every TimeoutSweepInterval in polling and webhook modes
+func (dp *Dispatcher) SweepTimeouts() error {
+	e, ok := dp.Storage.(storage.Expirer)
+	if !ok {
+		return nil
+	}
+	expired, err := e.PopExpired(time.Now())
+	for _, r := range expired {
+		state := fsm.ParseState(r.State)
+		for _, cb := range dp.OnTimeoutFunc {
+			dp.callTimeout(cb, r, state)
+		}
+	}
+	return err
+}
+
+// callTimeout calls callback, and recovers its panic
+func (dp *Dispatcher) callTimeout(cb TimeoutFunc, r storage.ExpiredRecord, state *fsm.State) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			dp.logger.Println("timeout callback panic:", rec)
+		}
+	}()
+	cb(dp, r.ChatID, r.UserID, state)
+}
+
+// startSweep calls SweepTimeouts every TimeoutSweepInterval, until Shutdown
+func (dp *Dispatcher) startSweep() {
+	if _, ok := dp.Storage.(storage.Expirer); !ok || dp.TimeoutSweepInterval <= 0 {
+		return
+	}
+	dp.closeMu.Lock()
+	ctx, cancel := context.WithCancel(context.Background())
+	dp.cancelSweep = cancel
+	dp.closeMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(dp.TimeoutSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := dp.SweepTimeouts(); err != nil {
+					dp.logger.Println(err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StateFilter returns state filter, which uses Storage of dispatcher,
+// KeyStrategy of dispatcher is used, when update is handled
+func (dp *Dispatcher) StateFilter(state *fsm.State) *filters.FSMStateFilter {
+	return filters.StateFilter(state, dp.Storage)
+}
+
+// StatesGroupFilter returns filter of any state of group,
+// which uses Storage of dispatcher, and its KeyStrategy, when update is handled
+func (dp *Dispatcher) StatesGroupFilter(group *fsm.StatesGroup) *filters.FSMGroupFilter {
+	return filters.StatesGroupFilter(group, dp.Storage)
+}
+
 // SkipUpdates skip comming updates, sending to telegram servers
 func (dp *Dispatcher) SkipUpdates() (err error) {
 	_, err = dp.Bot.GetUpdates(&GetUpdatesConfig{
@@ -226,8 +430,13 @@ func (dp *Dispatcher) Context(upd *objects.Update) *Context {
 		Bot:      dp.Bot,
 		Storage:  dp.Storage,
 		Markdown: dp.Bot.Markdown,
+		ctx:      context.Background(),
 		mu:       sync.Mutex{},
 		hasDone:  make(chan struct{}, 1),
+		scenes:   dp.scenes,
+
+		keyStrategy: dp.KeyStrategy,
+		dataLocks:   &dp.dataLocks,
 	}
 }
 
@@ -299,6 +508,7 @@ func (dp *Dispatcher) OnShutdown(c *OnConfig) {
 }
 
 func (dp *Dispatcher) start() {
+	dp.startSweep()
 	if dp.polling {
 		dp.startupPolling()
 	}
@@ -316,24 +526,129 @@ func (dp *Dispatcher) runShutDown() {
 	}
 }
 
-// stop ...
-func (dp *Dispatcher) stop() {
-	// bad design
-	if dp.isClose {
-		return
+// Shutdown stops fetching of updates, and waits until in-flight handlers
+// are finished, or ctx is done. After that commits offset of processed updates,
+// calls OnShutdown callbacks, and closes Storage. Process is not exited
+//
+// If handlers are not finished before ctx is done, offset is not committed,
+// so telegram sends unprocessed updates again, and ctx error is returned.
+// Contexts of running handlers are cancelled then, OnShutdown callbacks
+// are called, and Storage is closed in background, after handlers return
+func (dp *Dispatcher) Shutdown(ctx context.Context) error {
+	dp.closeMu.Lock()
+	if dp.closed != nil {
+		closed := dp.closed
+		dp.closeMu.Unlock()
+		select {
+		case <-closed:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	dp.closed = make(chan struct{})
+	if dp.cancelFetch != nil {
+		dp.cancelFetch()
 	}
-	dp.isClose = true
+	if dp.cancelSweep != nil {
+		dp.cancelSweep()
+	}
+	server := dp.server
+	dp.closeMu.Unlock()
+	defer close(dp.closed)
+
 	if dp.webhook {
-		errCh := make(chan error)
-		go func() { errCh <- dp.ResetWebhook(true) }()
-		<-errCh
-		close(errCh)
+		if err := dp.ResetWebhook(true); err != nil {
+			dp.logger.Println(err.Error())
+		}
+	}
+
+	err := waitContext(ctx, &dp.receiving)
+	if err == nil && server != nil {
+		err = server.Shutdown(ctx)
+	}
+	pool := dp.takePool()
+	if pool != nil {
+		pool.Close()
+		if err == nil {
+			err = pool.Wait(ctx)
+		}
+	}
+	if err != nil {
+		// handlers are still running, and can use storage
+		if dp.cancelHandlers != nil {
+			dp.cancelHandlers()
+		}
+		go func() {
+			if pool != nil {
+				pool.Wait(context.Background())
+			}
+			dp.finishShutdown()
+		}()
+		return err
 	}
+
+	if dp.polling {
+		err = dp.commitOffset(ctx)
+	}
+	dp.finishShutdown()
+	return err
+}
+
+// finishShutdown calls OnShutdown callbacks, and closes Storage,
+// it is called, when handlers are finished
+func (dp *Dispatcher) finishShutdown() {
+	dp.runShutDown()
 	if dp.Storage != nil {
 		dp.Storage.Close()
 	}
-	dp.runShutDown()
-	dp.closeChan <- struct{}{}
+	if dp.cancelHandlers != nil {
+		dp.cancelHandlers()
+	}
+}
+
+// commitOffset confirms updates, which is processed,
+// otherwise telegram sends them again on next getUpdates
+func (dp *Dispatcher) commitOffset(ctx context.Context) error {
+	dp.closeMu.Lock()
+	offset := dp.submitOffset
+	dp.closeMu.Unlock()
+
+	if offset == 0 {
+		return nil
+	}
+	_, err := dp.Bot.GetUpdatesContext(ctx, &GetUpdatesConfig{
+		Offset: offset,
+		Limit:  1,
+	})
+	return err
+}
+
+// waitShutdown blocks until Shutdown is finished, if it was called
+func (dp *Dispatcher) waitShutdown() {
+	dp.closeMu.Lock()
+	closed := dp.closed
+	dp.closeMu.Unlock()
+
+	if closed != nil {
+		<-closed
+	}
+}
+
+// fetchContext returns context derived from parent, which is cancelled by Shutdown
+func (dp *Dispatcher) fetchContext(parent context.Context) context.Context {
+	dp.closeMu.Lock()
+	defer dp.closeMu.Unlock()
+
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	if dp.closed != nil {
+		cancel()
+	}
+	dp.cancelFetch = cancel
+	return ctx
 }
 
 func (dp *Dispatcher) welcome() error {
@@ -347,71 +662,194 @@ func (dp *Dispatcher) welcome() error {
 	return nil
 }
 
+// safeExit calls Shutdown on SIGINT or SIGTERM,
+// second signal exits program without waiting
 func (dp *Dispatcher) safeExit() {
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		for range signals {
-			dp.stop()
-			os.Exit(0)
+		<-signals
+		go func() {
+			<-signals
+			os.Exit(1)
+		}()
+
+		if err := dp.shutdownTimeout(); err != nil {
+			dp.logger.Println(err.Error())
 		}
 	}()
 }
 
+// shutdownTimeout calls Shutdown with ShutdownTimeout
+func (dp *Dispatcher) shutdownTimeout() error {
+	ctx := context.Background()
+	if dp.ShutdownTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dp.ShutdownTimeout)
+		defer cancel()
+	}
+	return dp.Shutdown(ctx)
+}
+
 // =========================================
 //    Polling and webhook related methods
 // =========================================
 
 // GetUpdatesChan makes getUpdates request to telegram servers
 // sends update to updates channel
-// Time.Sleep here for stop goroutine for a c.Relax time
 //
-// yeah it bad, and works only on crutches, but works
+// ch is closed, when c.Context is done, Shutdown is called,
+// or polling is failed, error is logged in this case
 func (dp *Dispatcher) MakeUpdatesChan(c *PollingConfig, ch chan *objects.Update) {
+	ctx := dp.fetchContext(c.Context)
 	go func() {
-		for {
-			if c.Relax != 0 {
-				time.Sleep(c.Relax)
-			}
+		defer close(ch)
+		if err := dp.pollUpdates(ctx, c, ch); err != nil {
+			dp.logger.Println(err.Error())
+		}
+	}()
+}
 
-			updates, err := dp.Bot.GetUpdates(c.GetUpdatesConfig)
-			if err != nil {
-				dp.logger.Println(err.Error())
-				dp.logger.Println("Error with getting updates")
-				time.Sleep(c.ErrorSleep)
+// isFatalPollingError reports, that polling can not be continued,
+// token is revoked, or another instance gets updates, or webhook is set
+func isFatalPollingError(err error) bool {
+	return errors.Is(err, objects.ErrUnauthorized) || errors.Is(err, objects.ErrConflict)
+}
+
+// pollUpdates makes long polling getUpdates requests, until ctx is done
+// temporary errors are logged, and request is repeated after c.ErrorSleep
+// c.Offset is advanced after every received update
+func (dp *Dispatcher) pollUpdates(ctx context.Context, c *PollingConfig, ch chan<- *objects.Update) error {
+	conf := GetUpdatesConfig{}
+	if c.GetUpdatesConfig != nil {
+		conf = *c.GetUpdatesConfig
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = uint(c.Timeout / time.Second)
+	}
 
-				continue
+	for {
+		if c.Relax != 0 {
+			if sleepContext(ctx, c.Relax) != nil {
+				return nil
 			}
+		}
+
+		updates, err := dp.Bot.GetUpdatesContext(ctx, &conf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if isFatalPollingError(err) {
+				return err
+			}
+			dp.logger.Println(err.Error())
+			dp.logger.Println("Error with getting updates")
+			if sleepContext(ctx, c.ErrorSleep) != nil {
+				return nil
+			}
+
+			continue
+		}
 
-			for _, update := range updates {
-				if update.UpdateID >= c.Offset {
-					c.Offset = update.UpdateID + 1
-					ch <- update
+		for _, update := range updates {
+			if update.UpdateID >= conf.Offset {
+				select {
+				case ch <- update:
+					conf.Offset = update.UpdateID + 1
+					if c.GetUpdatesConfig != nil {
+						c.Offset = conf.Offset
+					}
+				case <-ctx.Done():
+					return nil
 				}
 			}
 		}
-	}()
+	}
 }
 
-// ProcessUpdates iterates <-chan *objects.Update
+// processUpdate uses by worker pool, errors only logged
+// because nobody waits for them
+func (dp *Dispatcher) processUpdate(upd *objects.Update) {
+	ctx := dp.handlersCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := dp.ProcessOneUpdateContext(ctx, upd); err != nil {
+		dp.logger.Println(err.Error())
+	}
+}
+
+// workerPool returns worker pool of dispatcher, creates it if not exists,
+// ErrorDispatcherClosed is returned, if Shutdown is called
+func (dp *Dispatcher) workerPool(workers, queueSize int) (*WorkerPool, error) {
+	dp.closeMu.Lock()
+	defer dp.closeMu.Unlock()
+
+	if dp.closed != nil {
+		return nil, ErrorDispatcherClosed
+	}
+	if dp.pool == nil {
+		dp.pool = NewWorkerPool(workers, queueSize, dp.processUpdate)
+	}
+	return dp.pool, nil
+}
+
+// takePool removes worker pool from dispatcher, and returns it to Shutdown,
+// which drains it
+func (dp *Dispatcher) takePool() *WorkerPool {
+	dp.closeMu.Lock()
+	defer dp.closeMu.Unlock()
+
+	pool := dp.pool
+	dp.pool = nil
+	return pool
+}
+
+// releasePool closes pool, and removes it from dispatcher, if it is still there
+func (dp *Dispatcher) releasePool(pool *WorkerPool) {
+	pool.Close()
+	dp.closeMu.Lock()
+	if dp.pool == pool {
+		dp.pool = nil
+	}
+	dp.closeMu.Unlock()
+}
+
+// ProcessUpdates iterates <-chan *objects.Update, and sends updates to worker pool
+// When channel is closed, waits until queued updates is processed
 func (dp *Dispatcher) ProcessUpdates(ch <-chan *objects.Update) error {
-	cherr := make(chan error, 1)
+	pool, err := dp.workerPool(DefaultMaxConcurrency, DefaultQueueSize)
+	if err != nil {
+		return err
+	}
+	err = dp.receive(context.Background(), ch, pool)
+	dp.releasePool(pool)
+	if werr := pool.Wait(context.Background()); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// receive submits updates from ch to pool, until ch is closed, or ctx is done
+// update, which is not submitted, is not committed, so telegram sends it again
+func (dp *Dispatcher) receive(ctx context.Context, ch <-chan *objects.Update, pool *WorkerPool) error {
+	dp.receiving.Add(1)
+	defer dp.receiving.Done()
 
 	for upd := range ch {
 		if upd == nil {
 			continue
 		}
-		go func() { cherr <- dp.ProcessOneUpdate(upd) }()
-
-		select {
-		case err := <-cherr:
-			if err != nil {
-				return err
+		if err := pool.Submit(ctx, upd); err != nil {
+			if ctx.Err() != nil {
+				return nil
 			}
-		case <-dp.closeChan:
-			dp.stop()
-			return nil
+			return err
 		}
+		dp.closeMu.Lock()
+		dp.submitOffset = upd.UpdateID + 1
+		dp.closeMu.Unlock()
 	}
 	return nil
 }
@@ -420,14 +858,17 @@ func (dp *Dispatcher) ProcessUpdates(ch <-chan *objects.Update) error {
 // If yes, Telegram Get to your bot a Update
 // Using GetUpdates method in Bot structure
 // GetUpdates config using for getUpdates method
+//
+// RunPolling returns after c.Context is done, or Shutdown is called,
+// handlers are finished by then. Error is returned, if polling is failed
+// with error, which can not be fixed by retry, e.g wrong token.
+// ErrorDispatcherClosed is returned, if Shutdown is already called
 func (dp *Dispatcher) RunPolling(c *PollingConfig) error {
 	var err error
 	if dp.webhook {
 		return ErrorConflictModes
 	}
 
-	dp.polling = true
-	dp.start()
 	if c.ResetWebhook {
 		err = dp.ResetWebhook(true)
 		if err != nil {
@@ -435,10 +876,6 @@ func (dp *Dispatcher) RunPolling(c *PollingConfig) error {
 		}
 	}
 
-	if c.SafeExit {
-		dp.safeExit()
-	}
-
 	if c.SkipUpdates {
 		err = dp.SkipUpdates()
 		if err != nil {
@@ -446,12 +883,39 @@ func (dp *Dispatcher) RunPolling(c *PollingConfig) error {
 		}
 	}
 
+	pool, err := dp.workerPool(c.MaxConcurrency, c.QueueSize)
+	if err != nil {
+		return err
+	}
+	dp.polling = true
+	dp.start()
+	if c.SafeExit {
+		dp.safeExit()
+	}
+
 	ch := make(chan *objects.Update)
 	dp.Debugch = ch
-	dp.MakeUpdatesChan(c, ch)
+	ctx, cancel := context.WithCancel(dp.fetchContext(c.Context))
+	defer cancel()
+	pollErr := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		pollErr <- dp.pollUpdates(ctx, c, ch)
+	}()
 
-	dp.ProcessUpdates(ch)
-	return nil
+	if err = dp.receive(ctx, ch, pool); err != nil {
+		// polling goroutine is blocked on ch, until fetching is cancelled
+		cancel()
+		<-pollErr
+		dp.releasePool(pool)
+		return err
+	}
+	// if Shutdown is already called, waits until it is finished
+	err = dp.shutdownTimeout()
+	if perr := <-pollErr; perr != nil {
+		return perr
+	}
+	return err
 }
 
 // MakeWebhookChan adds a http Handler with c.BotURL path
@@ -475,6 +939,7 @@ func (dp *Dispatcher) MakeWebhookChan(c *StartWebhookConfig, ch chan *objects.Up
 // Startup method executes after SetWebhook method call
 //
 // NOTE: you should to add a webhook close callback function, using OnShutdown
+// RunWebhook returns, when Shutdown is finished
 func (dp *Dispatcher) RunWebhook(c *StartWebhookConfig) error {
 	if dp.polling {
 		panic(ErrorConflictModes)
@@ -484,6 +949,10 @@ func (dp *Dispatcher) RunWebhook(c *StartWebhookConfig) error {
 	if err != nil {
 		return err
 	}
+	pool, err := dp.workerPool(c.MaxConcurrency, c.QueueSize)
+	if err != nil {
+		return err
+	}
 	dp.webhook = true
 	if c.SafeExit {
 		dp.safeExit()
@@ -496,7 +965,9 @@ func (dp *Dispatcher) RunWebhook(c *StartWebhookConfig) error {
 			return
 		}
 
-		err = dp.ProcessOneUpdate(update) // will run in stock mode
+		// update is processed after response, so telegram does not wait for handlers
+		// if queue is full, request waits for free space
+		err = pool.Submit(req.Context(), update)
 		if err != nil {
 			WriteRequestError(wr, err)
 			return
@@ -519,5 +990,16 @@ func (dp *Dispatcher) RunWebhook(c *StartWebhookConfig) error {
 	if err != nil {
 		return err
 	}
-	return http.ListenAndServeTLS(c.Address, certPath, keyfile, c.Handler)
+
+	server := &http.Server{Addr: c.Address, Handler: c.Handler}
+	dp.closeMu.Lock()
+	dp.server = server
+	dp.closeMu.Unlock()
+
+	err = server.ListenAndServeTLS(certPath, keyfile)
+	if err == http.ErrServerClosed {
+		dp.waitShutdown()
+		return nil
+	}
+	return err
 }
@@ -1,8 +1,14 @@
 package tgp
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pikoUsername/tgp/fsm"
 	"github.com/pikoUsername/tgp/fsm/storage"
 	"github.com/pikoUsername/tgp/objects"
 )
@@ -60,3 +66,451 @@ func BenchmarkProcessOneUpdate(b *testing.B) {
 		dp.ProcessOneUpdate(upd)
 	}
 }
+
+func TestMigrateChat(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	called := 0
+	dp.OnChatMigrate(func(dp *Dispatcher, from, to int64) { called++ })
+
+	dp.Storage.SetState(-1, 1000, "group:state")
+	dp.MigrateChat(-1, -1001)
+	dp.MigrateChat(-1, -1001)
+
+	state, _ := dp.Storage.GetState(-1001, 1000)
+	if state != "group:state" {
+		t.Fatal("state is not moved to new chat", state)
+	}
+	if called != 1 {
+		t.Fatal("wrong count of hook calls", called)
+	}
+}
+
+func TestMigrateChatKey(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.KeyStrategy = fsm.ChatKey
+	user := &objects.User{ID: 2}
+
+	ctx := dp.Context(&objects.Update{Message: &objects.Message{Chat: &objects.Chat{ID: -1}, From: user}})
+	ctx.SetState(fsm.NewState("shared"))
+	dp.MigrateChat(-1, -1001)
+
+	ctx = dp.Context(&objects.Update{Message: &objects.Message{Chat: &objects.Chat{ID: -1001}, From: user}})
+	if state, _ := ctx.GetState(); state.State != "shared" {
+		t.Fatal("state of chat is lost after migration", state)
+	}
+}
+
+// failMigrator fails first migration of chat
+type failMigrator struct {
+	*storage.MemoryStorage
+	failed bool
+}
+
+func (fm *failMigrator) MigrateChat(from, to int64) error {
+	if !fm.failed {
+		fm.failed = true
+		return errors.New("storage is unavailable")
+	}
+	return fm.MemoryStorage.MigrateChat(from, to)
+}
+
+func TestMigrateChatRetry(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.Storage = &failMigrator{MemoryStorage: storage.NewMemoryStorage()}
+
+	dp.Storage.SetState(-1, 1000, "group:state")
+	if err := dp.MigrateChat(-1, -1001); err == nil {
+		t.Fatal("error of storage is not returned")
+	}
+	if err := dp.MigrateChat(-1, -1001); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := dp.Storage.GetState(-1001, 1000); state != "group:state" {
+		t.Fatal("failed migration is not retried", state)
+	}
+}
+
+func TestProcessInlineQuery(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var query string
+	dp.InlineQueryHandler.HandlerFunc(func(ctx *Context) {
+		query = ctx.InlineQuery.Query
+	})
+
+	err = dp.ProcessOneUpdate(&objects.Update{
+		InlineQuery: &objects.InlineQuery{Id: "1", Query: "cats"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "cats" {
+		t.Fatal("inline query handler is not called")
+	}
+}
+
+func TestProcessPreCheckoutQuery(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload string
+	dp.PreCheckoutQueryHandler.HandlerFunc(func(ctx *Context) {
+		payload = ctx.PreCheckoutQuery.InvoicePayload
+	})
+
+	err = dp.ProcessOneUpdate(&objects.Update{
+		PreCheckoutQuery: &objects.PreCheckoutQuery{ID: "1", InvoicePayload: "order-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != "order-1" {
+		t.Fatal("pre checkout query handler is not called")
+	}
+}
+
+func TestProcessEditedMessage(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edited, message bool
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		message = true
+	})
+	dp.EditedMessageHandler.HandlerFunc(func(ctx *Context) {
+		edited = true
+	}).Command("start")
+
+	err = dp.ProcessOneUpdate(&objects.Update{
+		EditedMessage: &objects.Message{
+			Text: "/start",
+			Chat: &objects.Chat{ID: 1, Type: "private"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !edited {
+		t.Fatal("edited message handler is not called")
+	}
+	if message {
+		t.Fatal("message handler is called on edited message")
+	}
+}
+
+type closeStorage struct {
+	*storage.MemoryStorage
+	closed bool
+}
+
+func (cs *closeStorage) Close() {
+	cs.closed = true
+}
+
+func TestShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var committed string
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.FormValue("offset") == "":
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":1,"text":"hi","chat":{"id":1,"type":"private"}}}]}`))
+		case r.FormValue("timeout") == "":
+			mu.Lock()
+			committed = r.FormValue("offset")
+			mu.Unlock()
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+		default:
+			// long polling, until request is cancelled
+			<-r.Context().Done()
+		}
+	})
+	st := &closeStorage{MemoryStorage: storage.NewMemoryStorage()}
+	dp := NewDispatcher(b, st)
+	dp.Welcome = false
+
+	started := make(chan struct{})
+	var finished bool
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		finished = true
+	})
+	var hooked bool
+	dp.OnShutdown(NewOnConf(func(dp *Dispatcher) {
+		hooked = true
+	}))
+
+	c := NewPollingConfig(false)
+	c.SafeExit = false
+	c.Relax = 0
+	errCh := make(chan error, 1)
+	go func() { errCh <- dp.RunPolling(c) }()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := dp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !finished {
+		t.Fatal("shutdown does not wait for handler")
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if committed != "2" {
+		t.Fatal("offset is not committed", committed)
+	}
+	if !hooked || !st.closed {
+		t.Fatal("shutdown hooks is not called, or storage is not closed")
+	}
+}
+
+// chanStorage closes channel on Close
+type chanStorage struct {
+	*storage.MemoryStorage
+	closed chan struct{}
+}
+
+func (cs *chanStorage) Close() {
+	close(cs.closed)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("offset") == "" {
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":1,"text":"hi","chat":{"id":1,"type":"private"}}}]}`))
+			return
+		}
+		<-r.Context().Done()
+	})
+	st := &chanStorage{MemoryStorage: storage.NewMemoryStorage(), closed: make(chan struct{})}
+	dp := NewDispatcher(b, st)
+	dp.Welcome = false
+
+	started := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		close(started)
+		<-ctx.Context().Done()
+		select {
+		case <-st.closed:
+			handlerErr <- errors.New("storage is closed before handler is finished")
+		default:
+			handlerErr <- nil
+		}
+	})
+
+	c := NewPollingConfig(false)
+	c.SafeExit = false
+	go dp.RunPolling(c)
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := dp.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatal("wrong error of shutdown", err)
+	}
+	select {
+	case err := <-handlerErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler context is not cancelled")
+	}
+	select {
+	case <-st.closed:
+	case <-time.After(time.Second):
+		t.Fatal("storage is not closed after handler is finished")
+	}
+}
+
+func TestProcessUpdatesTwice(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	processed := 0
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		mu.Lock()
+		processed++
+		mu.Unlock()
+	})
+
+	for i := int64(1); i <= 2; i++ {
+		ch := make(chan *objects.Update, 1)
+		ch <- messageUpdate(i, i, "")
+		close(ch)
+		if err := dp.ProcessUpdates(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if processed != 2 {
+		t.Fatal("wrong count of processed updates", processed)
+	}
+}
+
+func TestRunAfterShutdown(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.Welcome = false
+	if err := dp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *objects.Update)
+	close(ch)
+	if err := dp.ProcessUpdates(ch); err != ErrorDispatcherClosed {
+		t.Fatal("wrong error of ProcessUpdates after shutdown", err)
+	}
+	c := NewPollingConfig(false)
+	c.SafeExit = false
+	if err := dp.RunPolling(c); err != ErrorDispatcherClosed {
+		t.Fatal("wrong error of RunPolling after shutdown", err)
+	}
+}
+
+func TestRunPollingContext(t *testing.T) {
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.FormValue("limit") == "1":
+			// offset commit by shutdown
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+		case r.FormValue("timeout") != "30":
+			t.Error("long polling timeout is not set", r.FormValue("timeout"))
+		case r.FormValue("offset") == "":
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":5,"message":{"message_id":1,"text":"hi","chat":{"id":1,"type":"private"}}}]}`))
+		default:
+			<-r.Context().Done()
+		}
+	})
+	dp := NewDispatcher(b, storage.NewMemoryStorage())
+	dp.Welcome = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var text string
+	dp.MessageHandler.HandlerFunc(func(c *Context) {
+		text = c.Message.Text
+		cancel()
+	})
+
+	c := NewPollingConfig(false)
+	c.SafeExit = false
+	c.Context = ctx
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- dp.RunPolling(c) }()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("polling is not stopped by context")
+	}
+	if text != "hi" {
+		t.Fatal("update is not processed")
+	}
+	if c.Offset != 6 {
+		t.Fatal("wrong offset", c.Offset)
+	}
+	if c.Timeout != 30*time.Second || c.GetUpdatesConfig.Timeout != 0 {
+		t.Fatal("polling config is changed", c.GetUpdatesConfig.Timeout)
+	}
+}
+
+func TestRunPollingResetWebhookError(t *testing.T) {
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+	})
+	dp := NewDispatcher(b, storage.NewMemoryStorage())
+	dp.Welcome = false
+
+	c := NewPollingConfig(false)
+	c.SafeExit = false
+	c.ResetWebhook = true
+	if err := dp.RunPolling(c); !errors.Is(err, objects.ErrUnauthorized) {
+		t.Fatal("reset webhook error is not returned", err)
+	}
+	dp.closeMu.Lock()
+	defer dp.closeMu.Unlock()
+	if dp.cancelSweep != nil || dp.pool != nil {
+		t.Fatal("dispatcher is started before reset webhook")
+	}
+}
+
+func TestRunPollingUnauthorized(t *testing.T) {
+	b := getLocalBot(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+	})
+	dp := NewDispatcher(b, storage.NewMemoryStorage())
+	dp.Welcome = false
+
+	c := NewPollingConfig(false)
+	c.SafeExit = false
+	err := dp.RunPolling(c)
+	if !errors.Is(err, objects.ErrUnauthorized) {
+		t.Fatal("polling error is not returned", err)
+	}
+}
+
+func TestSweepTimeouts(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := fsm.NewStatesGroup("sweep", "name").WithTimeout(time.Millisecond)
+
+	var got *fsm.State
+	var chatID, userID int64
+	dp.OnTimeout(func(dp *Dispatcher, cid, uid int64, state *fsm.State) {
+		got, chatID, userID = state, cid, uid
+	})
+
+	ctx := dp.Context(messageUpdate(0, 1, "hi"))
+	if err := ctx.SetState(form.First()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := dp.SweepTimeouts(); err != nil {
+		t.Fatal(err)
+	}
+	if got != form.First() || chatID != 1 || userID != 2 {
+		t.Fatal("timeout callback is not called", got, chatID, userID)
+	}
+	if state, _ := ctx.GetState(); *state != *fsm.DefaultState {
+		t.Fatal("state is not reset", state)
+	}
+}
+
+func TestTimeoutNotSupported(t *testing.T) {
+	ctx := GetContext(t)
+	// storage without SetStateTTL
+	ctx.Storage = struct{ storage.Storage }{storage.NewMemoryStorage()}
+	err := ctx.SetState(fsm.NewState("name").WithTimeout(time.Second))
+	if err != ErrorTimeoutNotSupported {
+		t.Fatal("wrong error", err)
+	}
+}
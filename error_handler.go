@@ -0,0 +1,102 @@
+package tgp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+)
+
+// ErrorHandlerFunc handles errors returned by handlers, or added by Context.Error,
+// ctx is context of handler, so ErrorHandlerFunc can reply to user
+type ErrorHandlerFunc func(ctx *Context, err error)
+
+// ErrorFilter checks out error, ErrorHandlerFunc will be called only
+// when all filters are passed
+type ErrorFilter func(err error) bool
+
+// ErrorIs filter passes errors, which errors.Is(err, target)
+//
+// dp.OnError(func(ctx *tgp.Context, err error) {...}, tgp.ErrorIs(objects.ErrBotBlocked))
+func ErrorIs(target error) ErrorFilter {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+// ErrorAs filter passes errors, which can be converted to type of target,
+// target must be non-nil pointer, like in errors.As
+//
+// dp.OnError(func(ctx *tgp.Context, err error) {...}, tgp.ErrorAs(new(*tgp.PanicError)))
+func ErrorAs(target interface{}) ErrorFilter {
+	typ := reflect.TypeOf(target)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		panic(tgpErr.New("ErrorAs target must be a non-nil pointer"))
+	}
+	return func(err error) bool {
+		// new target for every check, because filters are called concurrently
+		return errors.As(err, reflect.New(typ.Elem()).Interface())
+	}
+}
+
+// PanicError is error, which is made from recovered panic of handler
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", pe.Value)
+}
+
+type errorHandler struct {
+	handler ErrorHandlerFunc
+	filters []ErrorFilter
+}
+
+func (eh *errorHandler) check(err error) bool {
+	for _, f := range eh.filters {
+		if !f(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// OnError registers error handler, error goes to first handler,
+// which filters is passed, in order of registration.
+// Errors which is not handled, returned by ProcessOneUpdate
+//
+//	dp.OnError(func(ctx *tgp.Context, err error) {
+//		ctx.Reply(tgp.NewReplyMessage("Something went wrong"))
+//	})
+func (dp *Dispatcher) OnError(h ErrorHandlerFunc, filters ...ErrorFilter) {
+	dp.errorHandlers = append(dp.errorHandlers, &errorHandler{handler: h, filters: filters})
+}
+
+// handleError calls first matched error handler, returns false if there is no one
+func (dp *Dispatcher) handleError(ctx *Context, err error) (handled bool) {
+	for _, eh := range dp.errorHandlers {
+		if eh.check(err) {
+			defer func() {
+				if r := recover(); r != nil {
+					dp.logger.Println("error handler panic:", r)
+				}
+			}()
+			eh.handler(ctx, err)
+			return true
+		}
+	}
+	return false
+}
+
+// propagate propagates update through routers,
+// and recovers handler panic to PanicError
+func (dp *Dispatcher) propagate(ctx *Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			ctx.AbortWithError(&PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	dp.Router.propagate(ctx)
+}
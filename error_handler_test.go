@@ -0,0 +1,61 @@
+package tgp
+
+import (
+	"errors"
+	"testing"
+)
+
+var errTest = errors.New("test error")
+
+func TestOnError(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.MessageHandler.Handle(func(ctx *Context) error {
+		return errTest
+	}).Command("fail")
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		panic("oops")
+	}).Command("panic")
+
+	var got error
+	dp.OnError(func(ctx *Context, err error) {
+		got = err
+	}, ErrorIs(errTest))
+	var panicked *PanicError
+	dp.OnError(func(ctx *Context, err error) {
+		errors.As(err, &panicked)
+	}, ErrorAs(new(*PanicError)))
+
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "/fail")); err != nil {
+		t.Fatal("handled error is returned", err)
+	}
+	if got != errTest {
+		t.Fatal("error handler is not called", got)
+	}
+
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "/panic")); err != nil {
+		t.Fatal("handled panic is returned", err)
+	}
+	if panicked == nil || panicked.Value != "oops" || len(panicked.Stack) == 0 {
+		t.Fatal("panic is not recovered", panicked)
+	}
+}
+
+func TestUnhandledError(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.MessageHandler.Handle(func(ctx *Context) error {
+		return errTest
+	})
+	dp.OnError(func(ctx *Context, err error) {
+		t.Fatal("error handler with not passed filter is called")
+	}, ErrorAs(new(*PanicError)))
+
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "hi")); err != errTest {
+		t.Fatal("unhandled error is not returned", err)
+	}
+}
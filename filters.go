@@ -1,6 +1,7 @@
 package tgp
 
 import (
+	"github.com/pikoUsername/tgp/fsm"
 	"github.com/pikoUsername/tgp/objects"
 )
 
@@ -15,12 +16,51 @@ type Filter interface {
 	Check(update *objects.Update) bool
 }
 
-// check out for filters
-func checkFilters(filters []Filter, upd *objects.Update) bool {
+// ValueFilter is Filter, which passes its result to handler,
+// e.g filters.CallbackDataFilter passes parsed callback data
+// value is set to Context by key, when all filters are passed
+type ValueFilter interface {
+	Filter
+	// CheckValue is Check, which also returns value for handler
+	CheckValue(update *objects.Update) (key string, value interface{}, ok bool)
+}
+
+// KeyFilter is Filter, which uses FSM storage key of update,
+// e.g filters.FSMStateFilter. Dispatcher checks it with own KeyStrategy
+type KeyFilter interface {
+	Filter
+	CheckKey(update *objects.Update, ks fsm.KeyStrategy) bool
+}
+
+// check out for filters, values of ValueFilter are set to context,
+// only if all filters are passed
+func checkFilters(filters []Filter, c *Context) bool {
+	var values map[string]interface{}
 	for _, filter := range filters {
-		if !filter.Check(upd) {
+		if kf, ok := filter.(KeyFilter); ok {
+			if !kf.CheckKey(c.Update, c.keyStrategy) {
+				return false
+			}
+			continue
+		}
+		vf, ok := filter.(ValueFilter)
+		if !ok {
+			if !filter.Check(c.Update) {
+				return false
+			}
+			continue
+		}
+		key, value, ok := vf.CheckValue(c.Update)
+		if !ok {
 			return false
 		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		values[key] = value
+	}
+	for key, value := range values {
+		c.Set(key, value)
 	}
 	return true
 }
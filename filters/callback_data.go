@@ -0,0 +1,273 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pikoUsername/tgp/objects"
+)
+
+// MaxCallbackDataLength is telegram limit for callback_data in bytes
+const MaxCallbackDataLength = 64
+
+// CallbackData is factory of callback_data strings, idea taken from aiogram
+// values packs to string with {Prefix}:{value}:{value} template
+//
+// vote := filters.NewCallbackData("vote", "action", "id")
+// data, err := vote.New("up", 42) // vote:up:42
+// dp.CallbackQueryHandler.HandlerFunc(...).Filters(vote.Filter(map[string]string{"action": "up"}))
+// id, err := ctx.CallbackValues().Int("id") // in handler
+type CallbackData struct {
+	Prefix string
+	Sep    string
+	Fields []string
+}
+
+// CallbackValues is parsed callback_data, key is field name
+type CallbackValues map[string]string
+
+// CallbackValuesKey is key of handler Context, by which CallbackDataFilter
+// sets parsed callback data, use Context.CallbackValues to get it
+const CallbackValuesKey = "callback_values"
+
+// NewCallbackData creates callback data factory, with ':' separator
+// panics, if prefix contains separator
+func NewCallbackData(prefix string, fields ...string) *CallbackData {
+	cd := &CallbackData{
+		Prefix: prefix,
+		Sep:    ":",
+		Fields: fields,
+	}
+	if err := cd.validate(); err != nil {
+		panic(err)
+	}
+	return cd
+}
+
+// validate checks separator and prefix, fields are exported,
+// so factory can be created without NewCallbackData
+func (cd *CallbackData) validate() error {
+	if cd.Sep == "" {
+		return fmt.Errorf("callback data %s: empty separator", cd.Prefix)
+	}
+	if strings.Contains(cd.Prefix, cd.Sep) {
+		return fmt.Errorf("callback data %s: prefix contains separator", cd.Prefix)
+	}
+	return nil
+}
+
+// New packs values to callback_data, values must be in same order as Fields
+// supported types is string, bool, integers and floats
+func (cd *CallbackData) New(values ...interface{}) (string, error) {
+	if err := cd.validate(); err != nil {
+		return "", err
+	}
+	if len(values) != len(cd.Fields) {
+		return "", fmt.Errorf("callback data %s: expected %d values, got %d", cd.Prefix, len(cd.Fields), len(values))
+	}
+
+	parts := make([]string, 0, len(values)+1)
+	parts = append(parts, cd.Prefix)
+	for i, value := range values {
+		s, err := formatCallbackValue(reflect.ValueOf(value))
+		if err != nil {
+			return "", fmt.Errorf("callback data %s: field %s: %v", cd.Prefix, cd.Fields[i], err)
+		}
+		if strings.Contains(s, cd.Sep) {
+			return "", fmt.Errorf("callback data %s: field %s contains separator", cd.Prefix, cd.Fields[i])
+		}
+		parts = append(parts, s)
+	}
+
+	data := strings.Join(parts, cd.Sep)
+	if len(data) > MaxCallbackDataLength {
+		return "", fmt.Errorf("callback data %s: length %d is greater than %d bytes", cd.Prefix, len(data), MaxCallbackDataLength)
+	}
+	return data, nil
+}
+
+// Pack packs struct fields to callback_data, field name takes from `cb` tag,
+// or from lowercased struct field name
+func (cd *CallbackData) Pack(v interface{}) (string, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return "", errors.New("callback data: Pack argument must be struct")
+	}
+	fields := structFields(rv)
+
+	values := make([]interface{}, len(cd.Fields))
+	for i, name := range cd.Fields {
+		f, ok := fields[name]
+		if !ok {
+			return "", fmt.Errorf("callback data %s: struct has not field %s", cd.Prefix, name)
+		}
+		values[i] = f.Interface()
+	}
+	return cd.New(values...)
+}
+
+// Parse parses callback_data, returns error if prefix or fields count is wrong
+func (cd *CallbackData) Parse(data string) (CallbackValues, error) {
+	if err := cd.validate(); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(data, cd.Sep)
+	if len(parts) == 0 || parts[0] != cd.Prefix {
+		return nil, fmt.Errorf("callback data %s: wrong prefix", cd.Prefix)
+	}
+	if len(parts)-1 != len(cd.Fields) {
+		return nil, fmt.Errorf("callback data %s: wrong fields count", cd.Prefix)
+	}
+
+	values := make(CallbackValues, len(cd.Fields))
+	for i, name := range cd.Fields {
+		values[name] = parts[i+1]
+	}
+	return values, nil
+}
+
+// Unpack parses callback_data to struct, v must be pointer to struct
+// struct fields matches like in Pack method
+func (cd *CallbackData) Unpack(data string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("callback data: Unpack argument must be pointer to struct")
+	}
+	values, err := cd.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	fields := structFields(rv.Elem())
+	for name, value := range values {
+		f, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := parseCallbackValue(f, value); err != nil {
+			return fmt.Errorf("callback data %s: field %s: %v", cd.Prefix, name, err)
+		}
+	}
+	return nil
+}
+
+// Filter returns filter for callback queries with this factory data,
+// conditions is field values, which must be equal
+func (cd *CallbackData) Filter(conditions map[string]string) *CallbackDataFilter {
+	return &CallbackDataFilter{
+		Data:       cd,
+		Conditions: conditions,
+	}
+}
+
+// Int returns field value as integer
+func (cv CallbackValues) Int(key string) (int64, error) {
+	return strconv.ParseInt(cv[key], 10, 64)
+}
+
+// Bool returns field value as boolean
+func (cv CallbackValues) Bool(key string) (bool, error) {
+	return strconv.ParseBool(cv[key])
+}
+
+// CallbackDataFilter checks out callback_data, which created by CallbackData
+type CallbackDataFilter struct {
+	Data       *CallbackData
+	Conditions map[string]string
+}
+
+func (cf *CallbackDataFilter) Check(u *objects.Update) bool {
+	_, _, ok := cf.CheckValue(u)
+	return ok
+}
+
+// CheckValue returns parsed callback data, which is set to handler Context
+func (cf *CallbackDataFilter) CheckValue(u *objects.Update) (string, interface{}, bool) {
+	if u.CallbackQuery == nil {
+		return "", nil, false
+	}
+	values, err := cf.Data.Parse(u.CallbackQuery.Data)
+	if err != nil {
+		return "", nil, false
+	}
+	for key, value := range cf.Conditions {
+		if values[key] != value {
+			return "", nil, false
+		}
+	}
+	return CallbackValuesKey, values, true
+}
+
+func structFields(rv reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		name := sf.Tag.Get("cb")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		fields[name] = rv.Field(i)
+	}
+	return fields
+}
+
+func formatCallbackValue(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Kind())
+}
+
+func parseCallbackValue(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		fl, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(fl)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Kind())
+	}
+	return nil
+}
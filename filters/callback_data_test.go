@@ -0,0 +1,70 @@
+package filters_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pikoUsername/tgp/filters"
+	"github.com/pikoUsername/tgp/objects"
+)
+
+type vote struct {
+	Action string `cb:"action"`
+	ID     int64  `cb:"id"`
+}
+
+func TestCallbackData(t *testing.T) {
+	cd := filters.NewCallbackData("vote", "action", "id")
+
+	data, err := cd.Pack(vote{Action: "up", ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != "vote:up:42" {
+		t.Fatal("wrong packed data", data)
+	}
+
+	var v vote
+	if err := cd.Unpack(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Action != "up" || v.ID != 42 {
+		t.Fatal("wrong unpacked data", v)
+	}
+
+	upd := &objects.Update{CallbackQuery: &objects.CallbackQuery{Data: data}}
+	if !cd.Filter(map[string]string{"action": "up"}).Check(upd) {
+		t.Fatal("filter is not passed")
+	}
+	if cd.Filter(map[string]string{"action": "down"}).Check(upd) {
+		t.Fatal("filter passed with wrong condition")
+	}
+}
+
+func TestCallbackDataLimits(t *testing.T) {
+	cd := filters.NewCallbackData("vote", "action")
+
+	if _, err := cd.New("a:b"); err == nil {
+		t.Fatal("separator in value is not detected")
+	}
+	if _, err := cd.New(strings.Repeat("a", 64)); err == nil {
+		t.Fatal("length limit is not checked")
+	}
+}
+
+func TestCallbackDataValidate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("prefix with separator is not detected")
+		}
+	}()
+
+	cd := &filters.CallbackData{Prefix: "vote", Fields: []string{"action"}}
+	if _, err := cd.New("up"); err == nil {
+		t.Fatal("empty separator is not detected")
+	}
+	if _, err := cd.Parse("vote:up"); err == nil {
+		t.Fatal("empty separator is not detected")
+	}
+	filters.NewCallbackData("vote:up", "id")
+}
@@ -7,18 +7,11 @@ type ChatTypeFilter struct {
 }
 
 func (ct *ChatTypeFilter) Check(u *objects.Update) bool {
-	var chat *objects.Chat
-
-	if u.EditedMessage != nil {
-		chat = u.EditedMessage.Chat
-	} else if u.ChannelPost != nil {
-		chat = u.ChannelPost.Chat
-	} else if u.Message != nil {
-		chat = u.Message.Chat
-	} else {
-		chat = &objects.Chat{}
+	msg := message(u)
+	if msg == nil || msg.Chat == nil {
+		return false
 	}
-	return chat.Type == ct.Ignore
+	return msg.Chat.Type == ct.Ignore
 }
 
 func ChatType(ig string) *ChatTypeFilter {
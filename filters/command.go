@@ -17,11 +17,11 @@ type CommandFilter struct {
 
 func (c *CommandFilter) Check(u *objects.Update) bool {
 	var mention string
-	text := u.Message.Text
-	if text == "" {
+	msg := message(u)
+	if msg == nil || msg.Text == "" {
 		return false
 	}
-	text_args := strings.Split(u.Message.Text, " ")
+	text_args := strings.Split(msg.Text, " ")
 	raw_text := text_args[0]
 
 	command := strings.ToLower(raw_text)
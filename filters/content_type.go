@@ -7,7 +7,11 @@ type ContentTypeFilter struct {
 }
 
 func (ct *ContentTypeFilter) Check(u *objects.Update) bool {
-	return u.Message.GetContentType() == ct.ctype
+	msg := message(u)
+	if msg == nil {
+		return false
+	}
+	return msg.GetContentType() == ct.ctype
 }
 
 func ContentType(ctype string) *ContentTypeFilter {
@@ -15,3 +19,8 @@ func ContentType(ctype string) *ContentTypeFilter {
 		ctype: ctype,
 	}
 }
+
+// SuccessfulPayment filters service messages about successful payment
+func SuccessfulPayment() *ContentTypeFilter {
+	return ContentType(objects.ContentTypeSuccessfulPayment)
+}
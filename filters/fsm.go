@@ -10,23 +10,24 @@ import (
 type FSMStateFilter struct {
 	Storage storage.Storage
 	State   *fsm.State
+	// KeyStrategy overrides KeyStrategy of dispatcher, which handles update,
+	// nil means strategy of dispatcher, or fsm.UserInChatKey in Check
+	KeyStrategy *fsm.KeyStrategy
 }
 
+// GetState returns state of update, empty if update has not storage key
 func (sf *FSMStateFilter) GetState(u *objects.Update) string {
-	var cid, uid int64
-
-	if u.Message != nil {
-		cid = u.Message.Chat.ID
-		uid = u.Message.From.ID
-	} else if u.EditedMessage != nil {
-		cid = u.EditedMessage.Chat.ID
-		uid = u.EditedMessage.From.ID
-	} else if u.Message.PinnedMessage != nil {
-		cid = u.Message.PinnedMessage.Chat.ID
-		uid = u.Message.PinnedMessage.From.ID
-	} else if u.Message.ReplyToMessage != nil {
-		cid = u.Message.ReplyToMessage.Chat.ID
-		uid = u.Message.ReplyToMessage.From.ID
+	return sf.getState(u, fsm.UserInChatKey)
+}
+
+// getState returns state of update, ks is used, if KeyStrategy is not set
+func (sf *FSMStateFilter) getState(u *objects.Update, ks fsm.KeyStrategy) string {
+	if sf.KeyStrategy != nil {
+		ks = *sf.KeyStrategy
+	}
+	cid, uid, ok := ks.Key(u)
+	if !ok {
+		return ""
 	}
 
 	state, err := sf.Storage.GetState(cid, uid)
@@ -41,7 +42,13 @@ func (sf *FSMStateFilter) checkState(state string) bool {
 }
 
 func (sf *FSMStateFilter) Check(u *objects.Update) bool {
-	state := sf.GetState(u)
+	return sf.CheckKey(u, fsm.UserInChatKey)
+}
+
+// CheckKey is Check, which uses ks, if KeyStrategy is not set,
+// dispatcher calls it with own KeyStrategy
+func (sf *FSMStateFilter) CheckKey(u *objects.Update, ks fsm.KeyStrategy) bool {
+	state := sf.getState(u, ks)
 	h := sf.checkState(state) || state == "*"
 	return h
 }
@@ -53,3 +60,26 @@ func StateFilter(state *fsm.State, storage storage.Storage) *FSMStateFilter {
 		Storage: storage,
 	}
 }
+
+// FSMGroupFilter passes, if current state is any state of group
+type FSMGroupFilter struct {
+	*FSMStateFilter
+	Group *fsm.StatesGroup
+}
+
+func (gf *FSMGroupFilter) Check(u *objects.Update) bool {
+	return gf.CheckKey(u, fsm.UserInChatKey)
+}
+
+// CheckKey is Check, which uses ks, if KeyStrategy is not set
+func (gf *FSMGroupFilter) CheckKey(u *objects.Update, ks fsm.KeyStrategy) bool {
+	return gf.Group.Contains(fsm.ParseState(gf.getState(u, ks)))
+}
+
+// StatesGroupFilter filters any state of group
+func StatesGroupFilter(group *fsm.StatesGroup, storage storage.Storage) *FSMGroupFilter {
+	return &FSMGroupFilter{
+		FSMStateFilter: &FSMStateFilter{Storage: storage},
+		Group:          group,
+	}
+}
@@ -2,6 +2,21 @@ package filters
 
 import "github.com/pikoUsername/tgp/objects"
 
+// message returns message of update, it could be
+// message, edited message, channel post or edited channel post
+func message(u *objects.Update) *objects.Message {
+	if u.Message != nil {
+		return u.Message
+	} else if u.EditedMessage != nil {
+		return u.EditedMessage
+	} else if u.ChannelPost != nil {
+		return u.ChannelPost
+	} else if u.EditedChannelPost != nil {
+		return u.EditedChannelPost
+	}
+	return nil
+}
+
 // Unreachable filter, always return false
 func Unreachable(upd *objects.Update) bool {
 	return false
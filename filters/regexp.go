@@ -12,9 +12,9 @@ type RegexpFilter struct {
 
 func (r *RegexpFilter) Check(u *objects.Update) bool {
 	var content string
-	if u.Message != nil {
-		content = u.Message.Text
-	} else if u.CallbackQuery != nil {
+	if msg := message(u); msg != nil {
+		content = msg.Text
+	} else if u.CallbackQuery != nil && u.CallbackQuery.Message != nil {
 		content = u.CallbackQuery.Message.Text
 	} else if u.Poll != nil {
 		content = u.Poll.Question
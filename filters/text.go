@@ -19,8 +19,8 @@ func (t *TextFilter) Check(u *objects.Update) bool {
 	var text string
 
 	// CheckOut for text
-	if u.Message != nil {
-		text = u.Message.Text
+	if msg := message(u); msg != nil {
+		text = msg.Text
 	} else if u.CallbackQuery != nil {
 		text = u.CallbackQuery.Data
 	} else if u.InlineQuery != nil {
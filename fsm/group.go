@@ -0,0 +1,113 @@
+package fsm
+
+import "time"
+
+// StatesGroup is ordered set of states, e.g steps of registration
+//
+// ```
+// Form := fsm.NewStatesGroup("form", "name", "age")
+// ctx.SetState(Form.First())
+// ...
+// ctx.SetState(Form.Next(state))
+// ```
+// Declared states can be found by ParseState, so Context.GetState
+// returns same state object, which was set
+type StatesGroup struct {
+	Name string
+
+	// Timeout is timeout of states, which have not own timeout
+	Timeout time.Duration
+
+	states []*State
+}
+
+// NewStatesGroup declares group with states in given order
+// group with same name redeclares states
+func NewStatesGroup(name string, states ...string) *StatesGroup {
+	g := &StatesGroup{Name: name}
+	for _, state := range states {
+		g.states = append(g.states, &State{State: state, GroupState: name, group: g})
+	}
+
+	declareGroup(name)
+	declaredMu.Lock()
+	for _, s := range g.states {
+		declared[s.GetFullState()] = s
+	}
+	declaredMu.Unlock()
+	return g
+}
+
+// WithTimeout sets timeout of group states
+func (g *StatesGroup) WithTimeout(timeout time.Duration) *StatesGroup {
+	g.Timeout = timeout
+	return g
+}
+
+// States returns states of group in declared order
+func (g *StatesGroup) States() []*State {
+	return g.states
+}
+
+// State returns state of group by name, nil if group has not it
+func (g *StatesGroup) State(name string) *State {
+	for _, s := range g.states {
+		if s.State == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Contains reports, that state belongs to group
+func (g *StatesGroup) Contains(state *State) bool {
+	return g.index(state) >= 0
+}
+
+func (g *StatesGroup) index(state *State) int {
+	if state == nil {
+		return -1
+	}
+	for i, s := range g.states {
+		if s.GetFullState() == state.GetFullState() {
+			return i
+		}
+	}
+	return -1
+}
+
+// First returns first state of group
+func (g *StatesGroup) First() *State {
+	if len(g.states) == 0 {
+		return nil
+	}
+	return g.states[0]
+}
+
+// Last returns last state of group
+func (g *StatesGroup) Last() *State {
+	if len(g.states) == 0 {
+		return nil
+	}
+	return g.states[len(g.states)-1]
+}
+
+// Next returns state after current one, nil if current is last
+// if current state is not in group, first state is returned
+func (g *StatesGroup) Next(current *State) *State {
+	i := g.index(current)
+	if i+1 >= len(g.states) {
+		return nil
+	}
+	return g.states[i+1]
+}
+
+// Previous returns state before current one,
+// nil if current is first, or is not in group
+func (g *StatesGroup) Previous(current *State) *State {
+	i := g.index(current)
+	if i <= 0 {
+		return nil
+	}
+	return g.states[i-1]
+}
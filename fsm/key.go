@@ -0,0 +1,112 @@
+package fsm
+
+import (
+	"github.com/pikoUsername/tgp/objects"
+)
+
+// KeyStrategy defines, which chat and user ids are used
+// as storage key of state and data
+type KeyStrategy int
+
+const (
+	// UserInChatKey - every user has own state in every chat, default
+	UserInChatKey KeyStrategy = iota
+	// UserKey - user has one state in all chats, and in private chat with bot
+	UserKey
+	// ChatKey - all users of chat share one state
+	ChatKey
+	// TopicKey - all users of forum topic share one state,
+	// messages outside of topics belong to general topic
+	TopicKey
+)
+
+// Key returns storage key of update, ok is false if update has not
+// chat, or user, which are needed by strategy, e.g Poll update
+//
+// Updates without chat, e.g inline queries, or callback queries of inline messages,
+// use user id as chat id, like in private chat with bot
+func (ks KeyStrategy) Key(u *objects.Update) (cid, uid int64, ok bool) {
+	chat, user, thread := updateIDs(u)
+	switch ks {
+	case UserKey:
+		return user, user, user != 0
+	case ChatKey:
+		return chat, chat, chat != 0
+	case TopicKey:
+		return chat, thread, chat != 0
+	default:
+		return chat, user, chat != 0 && user != 0
+	}
+}
+
+// updateIDs returns chat, user and forum topic of update, zero if it is absent
+func updateIDs(u *objects.Update) (chat, user, thread int64) {
+	switch {
+	case u.Message != nil:
+		return messageIDs(u.Message)
+	case u.EditedMessage != nil:
+		return messageIDs(u.EditedMessage)
+	case u.ChannelPost != nil:
+		return messageIDs(u.ChannelPost)
+	case u.EditedChannelPost != nil:
+		return messageIDs(u.EditedChannelPost)
+	case u.CallbackQuery != nil:
+		user = userID(u.CallbackQuery.From)
+		if m := u.CallbackQuery.Message; m != nil && m.Chat != nil {
+			chat, _, thread = messageIDs(m)
+			return chat, user, thread
+		}
+		return user, user, 0
+	case u.InlineQuery != nil:
+		user = userID(u.InlineQuery.From)
+	case u.ChosenInlineResult != nil:
+		user = userID(u.ChosenInlineResult.From)
+	case u.ShippingQuery != nil:
+		user = userID(u.ShippingQuery.From)
+	case u.PreCheckoutQuery != nil:
+		user = userID(u.PreCheckoutQuery.From)
+	case u.PollAnswer != nil:
+		user = userID(u.PollAnswer.User)
+	case u.MyChatMember != nil:
+		return chatMemberIDs(u.MyChatMember)
+	case u.ChatMember != nil:
+		return chatMemberIDs(u.ChatMember)
+	case u.ChatJoinRequest != nil:
+		if u.ChatJoinRequest.Chat != nil {
+			chat = u.ChatJoinRequest.Chat.ID
+		}
+		return chat, userID(u.ChatJoinRequest.From), 0
+	}
+	return user, user, 0
+}
+
+func messageIDs(m *objects.Message) (chat, user, thread int64) {
+	if m.Chat != nil {
+		chat = m.Chat.ID
+	}
+	switch {
+	case m.From != nil:
+		user = m.From.ID
+	case m.SenderChat != nil:
+		// channel posts, and anonymous admins
+		user = m.SenderChat.ID
+	}
+	if m.IsTopicMessage {
+		thread = m.MessageThreadID
+	}
+	return chat, user, thread
+}
+
+func chatMemberIDs(cm *objects.ChatMemberUpdated) (chat, user, thread int64) {
+	if cm.Chat != nil {
+		chat = cm.Chat.ID
+	}
+	return chat, userID(cm.From), 0
+}
+
+func userID(u *objects.User) int64 {
+	if u == nil {
+		return 0
+	}
+	return u.ID
+}
@@ -0,0 +1,44 @@
+package fsm_test
+
+import (
+	"testing"
+
+	"github.com/pikoUsername/tgp/fsm"
+	"github.com/pikoUsername/tgp/objects"
+)
+
+func TestKeyStrategy(t *testing.T) {
+	user := &objects.User{ID: 2}
+	group := &objects.Chat{ID: -1}
+	topic := &objects.Update{Message: &objects.Message{
+		Chat: group, From: user, MessageThreadID: 7, IsTopicMessage: true,
+	}}
+
+	cases := []struct {
+		name     string
+		ks       fsm.KeyStrategy
+		u        *objects.Update
+		cid, uid int64
+		ok       bool
+	}{
+		{"message", fsm.UserInChatKey, topic, -1, 2, true},
+		{"user", fsm.UserKey, topic, 2, 2, true},
+		{"chat", fsm.ChatKey, topic, -1, -1, true},
+		{"topic", fsm.TopicKey, topic, -1, 7, true},
+		{"general topic", fsm.TopicKey, &objects.Update{Message: &objects.Message{Chat: group, From: user}}, -1, 0, true},
+		{"callback query", fsm.UserInChatKey, &objects.Update{CallbackQuery: &objects.CallbackQuery{
+			From: user, Message: &objects.Message{Chat: group},
+		}}, -1, 2, true},
+		{"inline callback query", fsm.UserInChatKey, &objects.Update{CallbackQuery: &objects.CallbackQuery{From: user}}, 2, 2, true},
+		{"inline query", fsm.UserInChatKey, &objects.Update{InlineQuery: &objects.InlineQuery{From: user}}, 2, 2, true},
+		{"chat member", fsm.UserInChatKey, &objects.Update{ChatMember: &objects.ChatMemberUpdated{Chat: group, From: user}}, -1, 2, true},
+		{"join request", fsm.UserInChatKey, &objects.Update{ChatJoinRequest: &objects.ChatJoinRequest{Chat: group, From: user}}, -1, 2, true},
+		{"poll", fsm.UserInChatKey, &objects.Update{Poll: &objects.Poll{}}, 0, 0, false},
+	}
+	for _, c := range cases {
+		cid, uid, ok := c.ks.Key(c.u)
+		if cid != c.cid || uid != c.uid || ok != c.ok {
+			t.Errorf("%s: got (%d, %d, %t)", c.name, cid, uid, ok)
+		}
+	}
+}
@@ -1,9 +1,22 @@
 package fsm
 
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
 // State ...
 type State struct {
 	State      string
 	GroupState string
+
+	// Timeout is time, after which state is reset,
+	// if user does not go to another state, zero means timeout of group
+	Timeout time.Duration
+
+	// group is set, when state is declared by StatesGroup
+	group *StatesGroup
 }
 
 // GetFullState just creates string, with {GroupState}:{StateName} template
@@ -24,11 +37,33 @@ func (s *State) GetFullState() string {
 }
 
 // For NewState("...").Group("...")
+// group is declared, so ParseState can split state of this group
 func (s *State) Group(group string) *State {
+	declareGroup(group)
 	s.GroupState = group
 	return s
 }
 
+// WithTimeout sets timeout of state
+func (s *State) WithTimeout(timeout time.Duration) *State {
+	s.Timeout = timeout
+	return s
+}
+
+// GetTimeout returns timeout of state, or timeout of its group,
+// zero means state is not expired
+func (s *State) GetTimeout() time.Duration {
+	if s.Timeout == 0 && s.group != nil {
+		return s.group.Timeout
+	}
+	return s.Timeout
+}
+
+// StatesGroup returns group, which declares state, nil if state is not declared
+func (s *State) StatesGroup() *StatesGroup {
+	return s.group
+}
+
 // NewState init function
 func NewState(state string) *State {
 	return &State{
@@ -41,3 +76,63 @@ var (
 	DefaultState = NewState("")
 	AnyState     = NewState("*")
 )
+
+var (
+	declaredMu sync.RWMutex
+	// declared states by full state string
+	declared = map[string]*State{}
+	// declared names of groups
+	groups = map[string]struct{}{}
+)
+
+func declareGroup(group string) {
+	if group == "" {
+		return
+	}
+	declaredMu.Lock()
+	groups[group] = struct{}{}
+	declaredMu.Unlock()
+}
+
+// splitGroup returns longest declared group, which is prefix of full state,
+// and name of state, ok is false if there is no such group
+func splitGroup(full string) (group, state string, ok bool) {
+	declaredMu.RLock()
+	defer declaredMu.RUnlock()
+
+	for g := range groups {
+		if len(g) > len(group) && strings.HasPrefix(full, g+":") {
+			group, ok = g, true
+		}
+	}
+	if !ok {
+		return "", "", false
+	}
+	return group, full[len(group)+1:], true
+}
+
+// ParseState makes state from string, created by GetFullState,
+// if state is declared by StatesGroup, declared state is returned.
+// Group is split only if it is declared by StatesGroup or State.Group,
+// so name of state can contain ":"
+func ParseState(full string) *State {
+	switch full {
+	case "", "*":
+		return NewState(full)
+	}
+
+	declaredMu.RLock()
+	s, ok := declared[full]
+	declaredMu.RUnlock()
+	if ok {
+		return s
+	}
+
+	if strings.HasPrefix(full, "@:") {
+		return NewState(full[2:])
+	}
+	if group, state, ok := splitGroup(full); ok {
+		return &State{State: state, GroupState: group}
+	}
+	return NewState(full)
+}
@@ -2,6 +2,7 @@ package fsm_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/pikoUsername/tgp/fsm"
 )
@@ -22,3 +23,69 @@ func TestGetFullState(t *testing.T) {
 		t.Error("Not correct string formation")
 	}
 }
+
+func TestParseState(t *testing.T) {
+	s := fsm.ParseState(fsm.NewState("name").Group("form").GetFullState())
+	if s.State != "name" || s.GroupState != "form" {
+		t.Fatal("wrong parsed state", s.State, s.GroupState)
+	}
+	s = fsm.ParseState(fsm.NewState("name").GetFullState())
+	if s.State != "name" || s.GroupState != "" {
+		t.Fatal("wrong parsed state without group", s.State, s.GroupState)
+	}
+	if *fsm.ParseState("") != *fsm.DefaultState || *fsm.ParseState("*") != *fsm.AnyState {
+		t.Fatal("special states are not parsed")
+	}
+	if fsm.ParseState("").Group("changed"); fsm.DefaultState.GroupState != "" {
+		t.Fatal("default state is changed by parsed state")
+	}
+
+	s = fsm.ParseState("@:time:12")
+	if s.State != "time:12" || s.GroupState != "" {
+		t.Fatal("wrong parsed state with colon", s.State, s.GroupState)
+	}
+	s = fsm.ParseState(fsm.NewState("at:10").Group("booking").GetFullState())
+	if s.State != "at:10" || s.GroupState != "booking" {
+		t.Fatal("wrong parsed state of group with colon", s.State, s.GroupState)
+	}
+	s = fsm.ParseState("undeclared:state")
+	if s.State != "undeclared:state" || s.GroupState != "" {
+		t.Fatal("undeclared group is split", s.State, s.GroupState)
+	}
+}
+
+func TestStatesGroup(t *testing.T) {
+	form := fsm.NewStatesGroup("form", "name", "age", "photo")
+
+	name := form.First()
+	if name.GetFullState() != "form:name" || name.StatesGroup() != form {
+		t.Fatal("wrong first state", name.GetFullState())
+	}
+	if fsm.ParseState("form:age") != form.State("age") {
+		t.Fatal("declared state is not returned")
+	}
+	if form.Next(name) != form.State("age") || form.Next(form.Last()) != nil {
+		t.Fatal("wrong next state")
+	}
+	if form.Previous(form.State("age")) != name || form.Previous(name) != nil {
+		t.Fatal("wrong previous state")
+	}
+	if !form.Contains(fsm.NewState("photo").Group("form")) || form.Contains(fsm.NewState("photo")) {
+		t.Fatal("wrong contains")
+	}
+}
+
+func TestStateTimeout(t *testing.T) {
+	form := fsm.NewStatesGroup("timeout", "name", "age").WithTimeout(time.Minute)
+	form.State("age").WithTimeout(time.Second)
+
+	if form.State("name").GetTimeout() != time.Minute {
+		t.Fatal("timeout of group is not used", form.State("name").GetTimeout())
+	}
+	if form.State("age").GetTimeout() != time.Second {
+		t.Fatal("timeout of state is not used", form.State("age").GetTimeout())
+	}
+	if fsm.NewState("free").GetTimeout() != 0 {
+		t.Fatal("state without group has timeout")
+	}
+}
@@ -1,5 +1,11 @@
 package storage
 
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
 type PackType map[string]interface{}
 
 // Simple storage interface for saving data,
@@ -13,6 +19,41 @@ type Storage interface {
 	Close()
 }
 
+// Migrator is optional interface for Storage,
+// MigrateChat moves all records of chat to new chat id,
+// uses when group is upgraded to supergroup
+//
+// Record of chat itself, e.g made by fsm.ChatKey, has chat id as user id,
+// its user id is changed to new chat id too
+type Migrator interface {
+	MigrateChat(from, to int64) error
+}
+
+// migratedUser returns user id of record after migration of chat
+func migratedUser(uid, from, to int64) int64 {
+	if uid == from {
+		return to
+	}
+	return uid
+}
+
+// Expirer is optional interface for Storage, which supports timeouts of states
+// expired records are reset, when PopExpired is called by dispatcher
+type Expirer interface {
+	// SetStateTTL sets state, which expires after ttl
+	SetStateTTL(cid, uid int64, state string, ttl time.Duration) error
+	// PopExpired deletes records, which states are expired before now,
+	// and returns them, every expired record is returned only once
+	PopExpired(now time.Time) ([]ExpiredRecord, error)
+}
+
+// ExpiredRecord is record, which state is expired
+type ExpiredRecord struct {
+	ChatID int64
+	UserID int64
+	State  string
+}
+
 // StorageRecord uses for input, and output value type
 type StorageRecord struct {
 	Data  PackType
@@ -22,3 +63,61 @@ type StorageRecord struct {
 var (
 	EmptyRecord = StorageRecord{}
 )
+
+// Encode converts v to PackType using json, v is usually struct with json tags
+func Encode(v interface{}) (PackType, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodePack(b)
+}
+
+// Decode decodes data to v using json, v is usually pointer to struct
+func Decode(data PackType, v interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// decodePack decodes json object, which is created by json.Marshal of PackType
+// integer numbers are decoded to int64, not float64, so they are not rounded
+func decodePack(b []byte) (PackType, error) {
+	var data PackType
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	normalizeNumbers(data)
+	return data, nil
+}
+
+// normalizeNumbers replaces json.Number values by int64, or float64
+func normalizeNumbers(data PackType) {
+	for k, v := range data {
+		data[k] = normalizeNumber(v)
+	}
+}
+
+func normalizeNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeNumber(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumber(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodePackPreservesIntegers(t *testing.T) {
+	b, _ := json.Marshal(PackType{
+		"chat":  int64(-1001234567890123456),
+		"price": 9.5,
+		"list":  []interface{}{1, 2.5},
+	})
+	data, err := decodePack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["chat"] != int64(-1001234567890123456) {
+		t.Fatal("integer is rounded", data["chat"])
+	}
+	if data["price"] != 9.5 {
+		t.Fatal("wrong float", data["price"])
+	}
+	list := data["list"].([]interface{})
+	if list[0] != int64(1) || list[1] != 2.5 {
+		t.Fatal("wrong nested numbers", list)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	type form struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	data, err := Encode(form{Name: "piko", Age: 17})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["name"] != "piko" || data["age"] != int64(17) {
+		t.Fatal("wrong encoded data", data)
+	}
+
+	var f form
+	if err := Decode(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "piko" || f.Age != 17 {
+		t.Fatal("wrong decoded data", f)
+	}
+}
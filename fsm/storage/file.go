@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileConfig is configuration of FileStorage
+type FileConfig struct {
+	// Path of log file, created if not exists
+	Path string
+
+	// Sync makes every write flushed and synced to disk,
+	// otherwise writes are buffered until compaction, or Close
+	Sync bool
+
+	// CompactInterval is interval of log compaction,
+	// zero disables periodic compaction
+	CompactInterval time.Duration
+}
+
+// NewFileConfig returns config with default values
+//  Sync - true
+//  CompactInterval - 10 minutes
+func NewFileConfig(path string) *FileConfig {
+	return &FileConfig{
+		Path:            path,
+		Sync:            true,
+		CompactInterval: 10 * time.Minute,
+	}
+}
+
+// fileEntry is one line of log file
+type fileEntry struct {
+	Op    string   `json:"op"`
+	Chat  int64    `json:"c"`
+	User  int64    `json:"u,omitempty"`
+	State string   `json:"s,omitempty"`
+	Data  PackType `json:"d,omitempty"`
+	To    int64    `json:"to,omitempty"`
+	// Expires is expiration time of state in unix milliseconds
+	Expires int64 `json:"x,omitempty"`
+}
+
+const (
+	fileOpState   = "state"
+	fileOpData    = "data"
+	fileOpClear   = "clear"
+	fileOpMigrate = "migrate"
+)
+
+// ErrorCorruptLog is returned by NewFileStorage,
+// if completed line of log can not be decoded
+var ErrorCorruptLog = errors.New("storage: corrupt log entry")
+
+type recordKey struct {
+	chat, user int64
+}
+
+// FileStorage is persistent storage for single instance bots,
+// records are kept in memory, and every change is appended to log file
+// as json line. On open log is replayed, not completed last line,
+// which can be left after crash, is truncated, and corrupt completed
+// line makes NewFileStorage fail with ErrorCorruptLog
+//
+// Log is periodically compacted, compaction writes snapshot of records
+// to temporary file, and atomically renames it over log
+type FileStorage struct {
+	conf *FileConfig
+
+	mu      sync.Mutex
+	file    *os.File
+	wr      *bufio.Writer
+	records map[recordKey]*StorageRecord
+	// expiration time of states in unix milliseconds
+	expires map[recordKey]int64
+	// count of entries in log
+	entries int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFileStorage opens log file, and replays it
+func NewFileStorage(conf *FileConfig) (*FileStorage, error) {
+	fs := &FileStorage{
+		conf:    conf,
+		records: make(map[recordKey]*StorageRecord),
+		expires: make(map[recordKey]int64),
+		done:    make(chan struct{}),
+	}
+
+	file, err := os.OpenFile(conf.Path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.replay(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	fs.file = file
+	fs.wr = bufio.NewWriter(file)
+
+	if conf.CompactInterval > 0 {
+		fs.wg.Add(1)
+		go fs.compactLoop()
+	}
+	return fs, nil
+}
+
+// replay applies entries of log, and truncates not completed last line
+func (fs *FileStorage) replay(file *os.File) error {
+	rd := bufio.NewReader(file)
+	var offset int64
+	for n := 1; ; n++ {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !fs.applyLine(line) {
+			return fmt.Errorf("%w: line %d", ErrorCorruptLog, n)
+		}
+		offset += int64(len(line))
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (fs *FileStorage) applyLine(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return true
+	}
+	var e fileEntry
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&e); err != nil {
+		return false
+	}
+	normalizeNumbers(e.Data)
+	fs.apply(&e)
+	fs.entries++
+	return true
+}
+
+// apply changes records in memory
+func (fs *FileStorage) apply(e *fileEntry) {
+	key := recordKey{e.Chat, e.User}
+	switch e.Op {
+	case fileOpState:
+		fs.record(key).State = e.State
+		if e.Expires != 0 {
+			fs.expires[key] = e.Expires
+		} else {
+			delete(fs.expires, key)
+		}
+	case fileOpData:
+		fs.record(key).Data = e.Data
+	case fileOpClear:
+		delete(fs.records, key)
+		delete(fs.expires, key)
+	case fileOpMigrate:
+		for key, record := range fs.records {
+			if key.chat == e.Chat {
+				newKey := recordKey{e.To, migratedUser(key.user, e.Chat, e.To)}
+				delete(fs.records, key)
+				fs.records[newKey] = record
+				delete(fs.expires, newKey)
+				if expires, ok := fs.expires[key]; ok {
+					delete(fs.expires, key)
+					fs.expires[newKey] = expires
+				}
+			}
+		}
+	}
+}
+
+func (fs *FileStorage) record(key recordKey) *StorageRecord {
+	record, ok := fs.records[key]
+	if !ok {
+		record = &StorageRecord{}
+		fs.records[key] = record
+	}
+	return record
+}
+
+// write appends entry to log, and applies it
+func (fs *FileStorage) write(e *fileEntry) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.writeLocked(e)
+}
+
+func (fs *FileStorage) writeLocked(e *fileEntry) error {
+	if fs.file == nil {
+		return os.ErrClosed
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.wr.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if fs.conf.Sync {
+		if err := fs.flush(); err != nil {
+			return err
+		}
+	}
+	fs.apply(e)
+	fs.entries++
+	return nil
+}
+
+func (fs *FileStorage) flush() error {
+	if err := fs.wr.Flush(); err != nil {
+		return err
+	}
+	return fs.file.Sync()
+}
+
+// SetData saves copy of data
+func (fs *FileStorage) SetData(cid, uid int64, data PackType) error {
+	return fs.write(&fileEntry{Op: fileOpData, Chat: cid, User: uid, Data: copyPack(data)})
+}
+
+// GetData returns copy of data, nil if data is not set
+func (fs *FileStorage) GetData(cid, uid int64) (PackType, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if record, ok := fs.records[recordKey{cid, uid}]; ok {
+		return copyPack(record.Data), nil
+	}
+	return nil, nil
+}
+
+// SetState saves state
+func (fs *FileStorage) SetState(cid, uid int64, state string) error {
+	return fs.write(&fileEntry{Op: fileOpState, Chat: cid, User: uid, State: state})
+}
+
+// SetStateTTL saves state, which expires after ttl
+func (fs *FileStorage) SetStateTTL(cid, uid int64, state string, ttl time.Duration) error {
+	expires := time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+	return fs.write(&fileEntry{Op: fileOpState, Chat: cid, User: uid, State: state, Expires: expires})
+}
+
+// GetState returns empty string, if state is not set, or expired
+func (fs *FileStorage) GetState(cid, uid int64) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	key := recordKey{cid, uid}
+	record, ok := fs.records[key]
+	if !ok {
+		return "", nil
+	}
+	if expires, ok := fs.expires[key]; ok && expires <= time.Now().UnixNano()/int64(time.Millisecond) {
+		return "", nil
+	}
+	return record.State, nil
+}
+
+// PopExpired deletes records, which states are expired before now
+func (fs *FileStorage) PopExpired(now time.Time) ([]ExpiredRecord, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	max := now.UnixNano() / int64(time.Millisecond)
+	var expired []ExpiredRecord
+	for key, expires := range fs.expires {
+		if expires > max {
+			continue
+		}
+		state := fs.records[key].State
+		if err := fs.writeLocked(&fileEntry{Op: fileOpClear, Chat: key.chat, User: key.user}); err != nil {
+			return expired, err
+		}
+		expired = append(expired, ExpiredRecord{ChatID: key.chat, UserID: key.user, State: state})
+	}
+	return expired, nil
+}
+
+// Clear deletes state and data
+func (fs *FileStorage) Clear(cid, uid int64) error {
+	return fs.write(&fileEntry{Op: fileOpClear, Chat: cid, User: uid})
+}
+
+// MigrateChat moves all records from chat to new chat
+func (fs *FileStorage) MigrateChat(from, to int64) error {
+	return fs.write(&fileEntry{Op: fileOpMigrate, Chat: from, To: to})
+}
+
+// Compact rewrites log, so it contains only current records
+func (fs *FileStorage) Compact() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.file == nil {
+		return os.ErrClosed
+	}
+	return fs.compact()
+}
+
+func (fs *FileStorage) compact() error {
+	tmpPath := fs.conf.Path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	wr := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(wr)
+	entries := 0
+	for key, record := range fs.records {
+		if record.State != "" {
+			e := &fileEntry{Op: fileOpState, Chat: key.chat, User: key.user, State: record.State, Expires: fs.expires[key]}
+			if err = enc.Encode(e); err != nil {
+				break
+			}
+			entries++
+		}
+		if record.Data != nil {
+			if err = enc.Encode(&fileEntry{Op: fileOpData, Chat: key.chat, User: key.user, Data: record.Data}); err != nil {
+				break
+			}
+			entries++
+		}
+	}
+	if err == nil {
+		err = wr.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, fs.conf.Path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	// buffered entries are already applied, and are in snapshot
+	fs.wr.Reset(tmp)
+	syncDir(filepath.Dir(fs.conf.Path))
+
+	fs.file.Close()
+	fs.file = tmp
+	fs.entries = entries
+	return nil
+}
+
+// syncDir makes rename durable, errors are ignored,
+// because not all platforms support syncing of directories
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	dir.Sync()
+	dir.Close()
+}
+
+// compactLoop compacts log every CompactInterval, if log has outdated entries
+func (fs *FileStorage) compactLoop() {
+	defer fs.wg.Done()
+	ticker := time.NewTicker(fs.conf.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fs.mu.Lock()
+			if fs.file != nil && fs.entries > 2*len(fs.records) {
+				fs.compact()
+			} else if fs.file != nil {
+				fs.flush()
+			}
+			fs.mu.Unlock()
+		case <-fs.done:
+			return
+		}
+	}
+}
+
+// Close stops compaction, compacts and flushes log, and closes file
+func (fs *FileStorage) Close() {
+	fs.mu.Lock()
+	if fs.file == nil {
+		fs.mu.Unlock()
+		return
+	}
+	close(fs.done)
+	fs.mu.Unlock()
+	fs.wg.Wait()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.compact() != nil {
+		fs.flush()
+	}
+	fs.file.Close()
+	fs.file = nil
+}
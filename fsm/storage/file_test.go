@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFileStorage(t *testing.T, path string) *FileStorage {
+	conf := NewFileConfig(path)
+	conf.CompactInterval = 0
+	fs, err := NewFileStorage(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestFileStorageReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.log")
+	fs := newTestFileStorage(t, path)
+
+	fs.SetState(1, 2, "state")
+	fs.SetData(1, 2, PackType{"name": "piko"})
+	fs.SetState(3, 4, "other")
+	fs.Clear(3, 4)
+	fs.SetState(-1, 5, "migrated")
+	fs.SetState(-1, -1, "chat")
+	fs.MigrateChat(-1, -100)
+	fs.Close()
+
+	fs = newTestFileStorage(t, path)
+	defer fs.Close()
+	if state, _ := fs.GetState(1, 2); state != "state" {
+		t.Fatal("state is not restored", state)
+	}
+	if data, _ := fs.GetData(1, 2); data["name"] != "piko" {
+		t.Fatal("data is not restored", data)
+	}
+	if state, _ := fs.GetState(3, 4); state != "" {
+		t.Fatal("cleared state is restored", state)
+	}
+	if state, _ := fs.GetState(-100, 5); state != "migrated" {
+		t.Fatal("state is not migrated", state)
+	}
+	if state, _ := fs.GetState(-100, -100); state != "chat" {
+		t.Fatal("state of chat is not migrated", state)
+	}
+}
+
+func TestFileStorageBrokenTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.log")
+	fs := newTestFileStorage(t, path)
+	fs.SetState(1, 2, "state")
+	// no Close, like after crash
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"state","c":1,"u":2,"s":"bro`)
+	f.Close()
+
+	fs2 := newTestFileStorage(t, path)
+	defer fs2.Close()
+	if state, _ := fs2.GetState(1, 2); state != "state" {
+		t.Fatal("state is not restored", state)
+	}
+	fs2.SetState(1, 2, "next")
+	fs2.Close()
+
+	fs3 := newTestFileStorage(t, path)
+	defer fs3.Close()
+	if state, _ := fs3.GetState(1, 2); state != "next" {
+		t.Fatal("write after broken tail is lost", state)
+	}
+}
+
+func TestFileStorageCorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.log")
+	log := `{"op":"state","c":1,"u":2,"s":"first"}` + "\n" +
+		`{"op":"state","c":1,"u":2,"s":"bro` + "\n" +
+		`{"op":"state","c":1,"u":3,"s":"last"}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(log), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStorage(NewFileConfig(path)); !errors.Is(err, ErrorCorruptLog) {
+		t.Fatal("corrupt line is not reported", err)
+	}
+	b, _ := ioutil.ReadFile(path)
+	if string(b) != log {
+		t.Fatal("log with corrupt line is truncated", string(b))
+	}
+}
+
+func TestFileStorageDataCopy(t *testing.T) {
+	fs := newTestFileStorage(t, filepath.Join(t.TempDir(), "fsm.log"))
+	defer fs.Close()
+
+	data := PackType{"name": "piko"}
+	fs.SetData(1, 2, data)
+	data["name"] = "changed"
+	got, _ := fs.GetData(1, 2)
+	if got["name"] != "piko" {
+		t.Fatal("stored data is changed by caller", got)
+	}
+	got["name"] = "changed"
+	if got, _ := fs.GetData(1, 2); got["name"] != "piko" {
+		t.Fatal("stored data is changed by returned map", got)
+	}
+}
+
+func TestFileStorageCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.log")
+	fs := newTestFileStorage(t, path)
+	defer fs.Close()
+
+	for i := 0; i < 100; i++ {
+		fs.SetState(1, 2, "state")
+	}
+	if err := fs.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"op":"state","c":1,"u":2,"s":"state"}`+"\n" {
+		t.Fatal("log is not compacted", string(b))
+	}
+
+	fs.SetState(1, 2, "after")
+	if state, _ := fs.GetState(1, 2); state != "after" {
+		t.Fatal("write after compaction failed", state)
+	}
+}
+
+func TestFileStoragePopExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.log")
+	fs := newTestFileStorage(t, path)
+
+	fs.SetStateTTL(1, 2, "form:name", time.Millisecond)
+	fs.SetStateTTL(1, 3, "form:name", time.Hour)
+	fs.Close()
+
+	// timeouts are restored after reopen
+	fs = newTestFileStorage(t, path)
+	defer fs.Close()
+	expired, err := fs.PopExpired(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0] != (ExpiredRecord{ChatID: 1, UserID: 2, State: "form:name"}) {
+		t.Fatal("wrong expired records", expired)
+	}
+	if state, _ := fs.GetState(1, 3); state != "form:name" {
+		t.Fatal("not expired state is deleted", state)
+	}
+}
@@ -1,72 +1,302 @@
 package storage
 
-// 2 dimensional dictionary(mapping(assaciative mapping))
-// First key is Chat id, second is User id
-type DataType map[int64]map[int64]*StorageRecord
+import (
+	"container/list"
+	"sync"
+	"time"
+)
 
-// Simple memory storage
+// MemoryConfig is configuration of MemoryStorage
+type MemoryConfig struct {
+	// TTL is time, after which record is deleted, if it is not changed,
+	// zero means records are not expired
+	TTL time.Duration
+
+	// MaxEntries is max count of records, when it is reached,
+	// least recently used record is evicted, zero means no limit
+	MaxEntries int
+
+	// SweepInterval is interval, in which expired by TTL records are deleted,
+	// zero means expired records are deleted only on access
+	SweepInterval time.Duration
+}
+
+type memoryRecord struct {
+	StorageRecord
+	// zero means record is not expired
+	expires time.Time
+	// expiration time of state, set by SetStateTTL
+	stateExpires time.Time
+	// element of lru list, value is recordKey
+	elem *list.Element
+}
+
+// expired reports, that record is expired by TTL before now,
+// record with state timeout is not expired, until PopExpired returns it
+func (r *memoryRecord) expired(now time.Time) bool {
+	return !r.expires.IsZero() && !now.Before(r.expires) && r.stateExpires.IsZero()
+}
+
+// MemoryStorage keeps records in memory, it is safe for concurrent use
+// Data is copied on SetData and GetData, so stored data can not be
+// changed outside of storage
 type MemoryStorage struct {
-	Data DataType
+	mu      sync.Mutex
+	records map[recordKey]*memoryRecord
+	// front is most recently used record
+	lru  *list.List
+	conf MemoryConfig
+
+	done chan struct{}
+	wg   sync.WaitGroup
 }
 
-// ResolveData ...
-func (ms *MemoryStorage) ResolveData(ChatId int64, UserId int64) *StorageRecord {
-	_, ok := ms.Data[ChatId][UserId]
-	if !ok {
-		ms.Data[ChatId] = map[int64]*StorageRecord{}
+// NewMemoryStorage returns storage without TTL and limit of records
+func NewMemoryStorage() *MemoryStorage {
+	return NewMemoryStorageConfig(&MemoryConfig{})
+}
+
+// NewMemoryStorageConfig returns storage with TTL and limit of records,
+// if SweepInterval is set, sweeper is started, it is stopped by Close
+func NewMemoryStorageConfig(conf *MemoryConfig) *MemoryStorage {
+	ms := &MemoryStorage{
+		records: make(map[recordKey]*memoryRecord),
+		lru:     list.New(),
+		conf:    *conf,
+		done:    make(chan struct{}),
 	}
-	record, ok := ms.Data[ChatId][UserId]
+	if conf.SweepInterval > 0 {
+		ms.wg.Add(1)
+		go ms.sweepLoop()
+	}
+	return ms
+}
 
+// sweepLoop deletes expired records every SweepInterval
+func (ms *MemoryStorage) sweepLoop() {
+	defer ms.wg.Done()
+	ticker := time.NewTicker(ms.conf.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ms.Sweep(now)
+		case <-ms.done:
+			return
+		}
+	}
+}
+
+// Sweep deletes records, which are expired by TTL before now
+// records with expired states are kept, until PopExpired returns them
+func (ms *MemoryStorage) Sweep(now time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for key, record := range ms.records {
+		if record.expired(now) {
+			ms.remove(key, record)
+		}
+	}
+}
+
+// lookup returns not expired record, and marks it as recently used,
+// nil if record does not exist
+func (ms *MemoryStorage) lookup(key recordKey) *memoryRecord {
+	record, ok := ms.records[key]
 	if !ok {
-		ms.Data[ChatId][UserId] = &StorageRecord{}
-		record = ms.Data[ChatId][UserId]
+		return nil
+	}
+	if record.expired(time.Now()) {
+		ms.remove(key, record)
+		return nil
 	}
+	ms.lru.MoveToFront(record.elem)
+	return record
+}
 
+// resolve returns record, creates it if not exists,
+// expiration time of record is renewed
+func (ms *MemoryStorage) resolve(key recordKey) *memoryRecord {
+	record := ms.lookup(key)
+	if record == nil {
+		record = &memoryRecord{}
+		record.elem = ms.lru.PushFront(key)
+		ms.records[key] = record
+		ms.evict()
+	}
+	if ms.conf.TTL > 0 {
+		record.expires = time.Now().Add(ms.conf.TTL)
+	}
 	return record
 }
 
-// SetData ...
+// evict removes least recently used records, while limit is exceeded
+func (ms *MemoryStorage) evict() {
+	for ms.conf.MaxEntries > 0 && len(ms.records) > ms.conf.MaxEntries {
+		key := ms.lru.Back().Value.(recordKey)
+		ms.remove(key, ms.records[key])
+	}
+}
+
+func (ms *MemoryStorage) remove(key recordKey, record *memoryRecord) {
+	ms.lru.Remove(record.elem)
+	delete(ms.records, key)
+}
+
+func copyPack(data PackType) PackType {
+	if data == nil {
+		return nil
+	}
+	cp := make(PackType, len(data))
+	for k, v := range data {
+		cp[k] = v
+	}
+	return cp
+}
+
+// SetData saves copy of data
 func (ms *MemoryStorage) SetData(cid, uid int64, data PackType) error {
-	record := ms.ResolveData(cid, uid)
-	record.Data = data
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.resolve(recordKey{cid, uid}).Data = copyPack(data)
 	return nil
 }
 
-// GetData ...
+// GetData returns copy of data, nil if data is not set
 func (ms *MemoryStorage) GetData(cid, uid int64) (PackType, error) {
-	return ms.ResolveData(cid, uid).Data, nil
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if record := ms.lookup(recordKey{cid, uid}); record != nil {
+		return copyPack(record.Data), nil
+	}
+	return nil, nil
 }
 
-// SetState ...
+// SetState saves state
 func (ms *MemoryStorage) SetState(cid, uid int64, state string) error {
-	record := ms.ResolveData(cid, uid)
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record := ms.resolve(recordKey{cid, uid})
+	record.State = state
+	record.stateExpires = time.Time{}
+	return nil
+}
+
+// SetStateTTL saves state, which expires after ttl
+func (ms *MemoryStorage) SetStateTTL(cid, uid int64, state string, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record := ms.resolve(recordKey{cid, uid})
 	record.State = state
+	record.stateExpires = time.Now().Add(ttl)
 	return nil
 }
 
-// GetState ...
+// GetState returns empty string, if state is not set, or expired
 func (ms *MemoryStorage) GetState(cid, uid int64) (string, error) {
-	return ms.ResolveData(cid, uid).State, nil
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record := ms.lookup(recordKey{cid, uid})
+	if record == nil || (!record.stateExpires.IsZero() && !time.Now().Before(record.stateExpires)) {
+		return "", nil
+	}
+	return record.State, nil
+}
+
+// PopExpired deletes records, which states are expired before now
+func (ms *MemoryStorage) PopExpired(now time.Time) ([]ExpiredRecord, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var expired []ExpiredRecord
+	for key, record := range ms.records {
+		if !record.stateExpires.IsZero() && !now.Before(record.stateExpires) {
+			expired = append(expired, ExpiredRecord{ChatID: key.chat, UserID: key.user, State: record.State})
+			ms.remove(key, record)
+		}
+	}
+	return expired, nil
 }
 
+// Expire sets TTL of record, it is renewed by TTL of config on next change,
+// zero ttl makes record not expired, does nothing if record does not exist
+func (ms *MemoryStorage) Expire(cid, uid int64, ttl time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if record := ms.lookup(recordKey{cid, uid}); record != nil {
+		if ttl > 0 {
+			record.expires = time.Now().Add(ttl)
+		} else {
+			record.expires = time.Time{}
+		}
+	}
+}
+
+// Len returns count of records, including expired, but not deleted yet
+func (ms *MemoryStorage) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return len(ms.records)
+}
+
+// Clear deletes state and data
 func (ms *MemoryStorage) Clear(cid, uid int64) error {
-	ms.Data[cid][uid] = nil
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := recordKey{cid, uid}
+	if record, ok := ms.records[key]; ok {
+		ms.remove(key, record)
+	}
 	return nil
 }
 
-// Deletes all stored data
-func (ms *MemoryStorage) Close() {
-	for key, value := range ms.Data {
-		for key := range value {
-			delete(value, key)
+// MigrateChat moves all records from chat to new chat,
+// records of new chat with same users are replaced
+func (ms *MemoryStorage) MigrateChat(from, to int64) error {
+	if from == to {
+		return nil
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for key, record := range ms.records {
+		if key.chat != from {
+			continue
+		}
+		newKey := recordKey{to, migratedUser(key.user, from, to)}
+		if old, ok := ms.records[newKey]; ok {
+			ms.remove(newKey, old)
 		}
-		delete(ms.Data, key)
+		delete(ms.records, key)
+		record.elem.Value = newKey
+		ms.records[newKey] = record
 	}
-	ms.Data = DataType{}
+	return nil
 }
 
-func NewMemoryStorage() *MemoryStorage {
-	return &MemoryStorage{
-		Data: DataType{},
+// Close stops sweeper, and deletes all stored data
+func (ms *MemoryStorage) Close() {
+	ms.mu.Lock()
+	select {
+	case <-ms.done:
+	default:
+		close(ms.done)
 	}
+	ms.mu.Unlock()
+	ms.wg.Wait()
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.records = make(map[recordKey]*memoryRecord)
+	ms.lru.Init()
 }
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ms := NewMemoryStorage()
+
+	ms.SetState(1, 2, "state")
+	// new user of existing chat does not overwrite chat
+	ms.SetState(1, 3, "other")
+	if state, _ := ms.GetState(1, 2); state != "state" {
+		t.Fatal("record is overwritten", state)
+	}
+
+	data := PackType{"name": "piko"}
+	ms.SetData(1, 2, data)
+	data["name"] = "changed"
+	if got, _ := ms.GetData(1, 2); got["name"] != "piko" {
+		t.Fatal("stored data is changed outside of storage", got)
+	}
+
+	// unknown chat
+	if err := ms.Clear(100, 2); err != nil {
+		t.Fatal(err)
+	}
+	ms.Clear(1, 2)
+	if state, _ := ms.GetState(1, 2); state != "" {
+		t.Fatal("record is not cleared", state)
+	}
+	// getters do not create records
+	if ms.Len() != 1 {
+		t.Fatal("wrong count of records", ms.Len())
+	}
+}
+
+func TestMemoryStorageConcurrent(t *testing.T) {
+	ms := NewMemoryStorageConfig(&MemoryConfig{MaxEntries: 5})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(uid int64) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ms.SetState(1, uid, "state")
+				ms.SetData(1, uid, PackType{"j": j})
+				ms.GetData(1, uid)
+				ms.GetState(1, uid)
+				ms.MigrateChat(2, 1)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+}
+
+func TestMemoryStorageTTL(t *testing.T) {
+	ms := NewMemoryStorageConfig(&MemoryConfig{TTL: 10 * time.Millisecond})
+
+	ms.SetState(1, 2, "state")
+	ms.SetState(1, 3, "state")
+	ms.Expire(1, 3, 0)
+	time.Sleep(20 * time.Millisecond)
+	if state, _ := ms.GetState(1, 2); state != "" {
+		t.Fatal("record is not expired", state)
+	}
+	if state, _ := ms.GetState(1, 3); state != "state" {
+		t.Fatal("record without ttl is expired", state)
+	}
+}
+
+func TestMemoryStorageEviction(t *testing.T) {
+	ms := NewMemoryStorageConfig(&MemoryConfig{MaxEntries: 2})
+
+	ms.SetState(1, 1, "first")
+	ms.SetState(1, 2, "second")
+	// first is recently used now
+	ms.GetState(1, 1)
+	ms.SetState(1, 3, "third")
+
+	if ms.Len() != 2 {
+		t.Fatal("limit is exceeded", ms.Len())
+	}
+	if state, _ := ms.GetState(1, 2); state != "" {
+		t.Fatal("least recently used record is not evicted", state)
+	}
+	if state, _ := ms.GetState(1, 1); state != "first" {
+		t.Fatal("recently used record is evicted", state)
+	}
+}
+
+func TestMemoryStorageMigrateChat(t *testing.T) {
+	ms := NewMemoryStorage()
+
+	ms.SetState(-1, 2, "old")
+	ms.SetState(-100, 2, "stale")
+	ms.SetState(-1, -1, "chat")
+	ms.MigrateChat(-1, -100)
+	if state, _ := ms.GetState(-100, 2); state != "old" {
+		t.Fatal("state is not migrated", state)
+	}
+	if state, _ := ms.GetState(-100, -100); state != "chat" {
+		t.Fatal("state of chat is not migrated", state)
+	}
+	if ms.Len() != 2 {
+		t.Fatal("wrong count of records", ms.Len())
+	}
+}
+
+func TestMemoryStoragePopExpired(t *testing.T) {
+	ms := NewMemoryStorage()
+
+	ms.SetStateTTL(1, 2, "form:name", time.Millisecond)
+	ms.SetStateTTL(1, 3, "form:name", time.Millisecond)
+	// timeout is cancelled by new state
+	ms.SetState(1, 3, "form:age")
+
+	time.Sleep(5 * time.Millisecond)
+	if state, _ := ms.GetState(1, 2); state != "" {
+		t.Fatal("expired state is returned", state)
+	}
+	expired, _ := ms.PopExpired(time.Now())
+	if len(expired) != 1 || expired[0] != (ExpiredRecord{ChatID: 1, UserID: 2, State: "form:name"}) {
+		t.Fatal("wrong expired records", expired)
+	}
+	if expired, _ := ms.PopExpired(time.Now()); len(expired) != 0 {
+		t.Fatal("expired record is returned twice", expired)
+	}
+}
+
+func TestMemoryStorageSweeper(t *testing.T) {
+	ms := NewMemoryStorageConfig(&MemoryConfig{
+		TTL:           time.Millisecond,
+		SweepInterval: time.Millisecond,
+	})
+	defer ms.Close()
+
+	ms.SetState(1, 2, "state")
+	time.Sleep(20 * time.Millisecond)
+	if ms.Len() != 0 {
+		t.Fatal("expired record is not swept", ms.Len())
+	}
+}
+
+func TestMemoryStorageSweepStateTimeout(t *testing.T) {
+	ms := NewMemoryStorageConfig(&MemoryConfig{TTL: time.Millisecond})
+
+	ms.SetStateTTL(1, 2, "form:name", time.Hour)
+	ms.Sweep(time.Now().Add(time.Minute))
+	if ms.Len() != 1 {
+		t.Fatal("record with state timeout is swept")
+	}
+	expired, _ := ms.PopExpired(time.Now().Add(2 * time.Hour))
+	if len(expired) != 1 || expired[0].State != "form:name" {
+		t.Fatal("state timeout is lost", expired)
+	}
+}
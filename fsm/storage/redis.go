@@ -0,0 +1,465 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisConfig is configuration of RedisStorage
+type RedisConfig struct {
+	// Addr is host:port of redis server
+	Addr     string
+	Password string
+	DB       int
+
+	// Prefix is added to all keys, default is "fsm"
+	Prefix string
+
+	// StateTTL and DataTTL are expiration time of records,
+	// zero means records are not expired
+	StateTTL time.Duration
+	DataTTL  time.Duration
+
+	// DialTimeout is timeout for connecting, default is 5 seconds
+	DialTimeout time.Duration
+	// Timeout is deadline of writing command and reading its reply,
+	// connection is reopened after timeout, default is 5 seconds
+	Timeout time.Duration
+}
+
+// NewRedisConfig returns config with default values
+func NewRedisConfig(addr string) *RedisConfig {
+	return &RedisConfig{
+		Addr:        addr,
+		Prefix:      "fsm",
+		DialTimeout: 5 * time.Second,
+		Timeout:     5 * time.Second,
+	}
+}
+
+// RedisStorage stores states and data in redis, or in any server,
+// which speaks redis protocol, data is serialized to json
+//
+// Keys have {prefix}:{chat id}:{user id}:state and {prefix}:{chat id}:{user id}:data format
+// timeouts of states are kept in sorted set {prefix}:timeouts
+// Storage uses one connection, connection is reopened after network error
+type RedisStorage struct {
+	conf *RedisConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+	wr   *bufio.Writer
+}
+
+// NewRedisStorage connects to redis server, and returns storage
+func NewRedisStorage(conf *RedisConfig) (*RedisStorage, error) {
+	if conf.Prefix == "" {
+		conf.Prefix = "fsm"
+	}
+	rs := &RedisStorage{conf: conf}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err := rs.connect(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// connect opens connection, authenticates, and selects database
+func (rs *RedisStorage) connect() error {
+	timeout := rs.conf.DialTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", rs.conf.Addr, timeout)
+	if err != nil {
+		return err
+	}
+	rs.conn = conn
+	rs.rd = bufio.NewReader(conn)
+	rs.wr = bufio.NewWriter(conn)
+
+	if rs.conf.Password != "" {
+		if _, err := rs.command("AUTH", rs.conf.Password); err != nil {
+			rs.disconnect()
+			return err
+		}
+	}
+	if rs.conf.DB != 0 {
+		if _, err := rs.command("SELECT", strconv.Itoa(rs.conf.DB)); err != nil {
+			rs.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *RedisStorage) disconnect() {
+	if rs.conn != nil {
+		rs.conn.Close()
+		rs.conn = nil
+	}
+}
+
+// command sends command to opened connection, and reads reply
+// connection is closed on network errors
+func (rs *RedisStorage) command(args ...string) (interface{}, error) {
+	timeout := rs.conf.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	if err := rs.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		rs.disconnect()
+		return nil, err
+	}
+	if err := writeCommand(rs.wr, args...); err != nil {
+		rs.disconnect()
+		return nil, err
+	}
+	reply, err := readReply(rs.rd)
+	if err != nil {
+		rs.disconnect()
+		return nil, err
+	}
+	if rerr, ok := reply.(RedisError); ok {
+		return nil, rerr
+	}
+	return reply, nil
+}
+
+// ensureConn opens connection, if it is closed, rs.mu must be held
+func (rs *RedisStorage) ensureConn() error {
+	if rs.conn == nil {
+		return rs.connect()
+	}
+	return nil
+}
+
+// Do sends command to server, connects if connection is closed
+func (rs *RedisStorage) Do(args ...string) (interface{}, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.ensureConn(); err != nil {
+		return nil, err
+	}
+	return rs.command(args...)
+}
+
+// exec runs commands atomically in MULTI/EXEC block, rs.mu must be held
+// nil replies are returned, if keys watched by WATCH are changed
+func (rs *RedisStorage) exec(cmds ...[]string) ([]interface{}, error) {
+	if _, err := rs.command("MULTI"); err != nil {
+		return nil, err
+	}
+	for _, args := range cmds {
+		if _, err := rs.command(args...); err != nil {
+			if rs.conn != nil {
+				rs.command("DISCARD")
+			}
+			return nil, err
+		}
+	}
+	reply, err := rs.command("EXEC")
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	replies, ok := reply.([]interface{})
+	if !ok {
+		return nil, errRespSyntax
+	}
+	return replies, nil
+}
+
+// multi runs commands atomically, connects if connection is closed
+func (rs *RedisStorage) multi(cmds ...[]string) ([]interface{}, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.ensureConn(); err != nil {
+		return nil, err
+	}
+	return rs.exec(cmds...)
+}
+
+func (rs *RedisStorage) key(cid, uid int64, kind string) string {
+	return rs.conf.Prefix + ":" + strconv.FormatInt(cid, 10) + ":" + strconv.FormatInt(uid, 10) + ":" + kind
+}
+
+// setCommand returns command, which sets value of key with ttl,
+// empty value deletes key
+func setCommand(key, value string, ttl time.Duration) []string {
+	switch {
+	case value == "":
+		return []string{"DEL", key}
+	case ttl > 0:
+		return []string{"SET", key, value, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10)}
+	}
+	return []string{"SET", key, value}
+}
+
+// set sets value of key with ttl, empty value deletes key
+func (rs *RedisStorage) set(key, value string, ttl time.Duration) error {
+	_, err := rs.Do(setCommand(key, value, ttl)...)
+	return err
+}
+
+// get returns value of key, empty string if key does not exist
+func (rs *RedisStorage) get(key string) (string, error) {
+	reply, err := rs.Do("GET", key)
+	if err != nil || reply == nil {
+		return "", err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", errRespSyntax
+	}
+	return value, nil
+}
+
+// SetData serializes data to json, and saves it with DataTTL
+func (rs *RedisStorage) SetData(cid, uid int64, data PackType) error {
+	if len(data) == 0 {
+		return rs.set(rs.key(cid, uid, "data"), "", 0)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return rs.set(rs.key(cid, uid, "data"), string(b), rs.conf.DataTTL)
+}
+
+// GetData returns nil, if data is not set, or expired
+func (rs *RedisStorage) GetData(cid, uid int64) (PackType, error) {
+	value, err := rs.get(rs.key(cid, uid, "data"))
+	if err != nil || value == "" {
+		return nil, err
+	}
+	return decodePack([]byte(value))
+}
+
+func (rs *RedisStorage) timeoutsKey() string {
+	return rs.conf.Prefix + ":timeouts"
+}
+
+func timeoutMember(cid, uid int64) string {
+	return strconv.FormatInt(cid, 10) + ":" + strconv.FormatInt(uid, 10)
+}
+
+// SetState saves state with StateTTL, empty state deletes record
+// timeout of previous state is cancelled
+func (rs *RedisStorage) SetState(cid, uid int64, state string) error {
+	_, err := rs.multi(
+		[]string{"ZREM", rs.timeoutsKey(), timeoutMember(cid, uid)},
+		setCommand(rs.key(cid, uid, "state"), state, rs.conf.StateTTL),
+	)
+	return err
+}
+
+// SetStateTTL saves state, and adds its timeout to sorted set of timeouts
+func (rs *RedisStorage) SetStateTTL(cid, uid int64, state string, ttl time.Duration) error {
+	expires := time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+	_, err := rs.multi(
+		setCommand(rs.key(cid, uid, "state"), state, rs.conf.StateTTL),
+		[]string{"ZADD", rs.timeoutsKey(), strconv.FormatInt(expires, 10), timeoutMember(cid, uid)},
+	)
+	return err
+}
+
+// PopExpired deletes records with expired states, record is returned,
+// only if this call removed it from set of timeouts,
+// so several bot instances do not handle same timeout
+//
+// Record is deleted in transaction, which is aborted,
+// if state, or data is changed by handler meanwhile
+func (rs *RedisStorage) PopExpired(now time.Time) ([]ExpiredRecord, error) {
+	max := now.UnixNano() / int64(time.Millisecond)
+	reply, err := rs.Do("ZRANGEBYSCORE", rs.timeoutsKey(), "-inf", strconv.FormatInt(max, 10))
+	if err != nil {
+		return nil, err
+	}
+	members, _ := reply.([]interface{})
+
+	var expired []ExpiredRecord
+	for _, m := range members {
+		member, _ := m.(string)
+		i := strings.Index(member, ":")
+		if i < 0 {
+			continue
+		}
+		cid, err1 := strconv.ParseInt(member[:i], 10, 64)
+		uid, err2 := strconv.ParseInt(member[i+1:], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		state, ok, err := rs.popExpired(cid, uid, max)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired = append(expired, ExpiredRecord{ChatID: cid, UserID: uid, State: state})
+		}
+	}
+	return expired, nil
+}
+
+// popExpired deletes record, if its timeout is not later than max,
+// ok is false, if record is changed, or deleted by another client
+func (rs *RedisStorage) popExpired(cid, uid, max int64) (state string, ok bool, err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.ensureConn(); err != nil {
+		return "", false, err
+	}
+	stateKey, dataKey := rs.key(cid, uid, "state"), rs.key(cid, uid, "data")
+	member := timeoutMember(cid, uid)
+
+	// state and its timeout are changed together by SetState and SetStateTTL,
+	// so watching keys of record is enough to detect new state
+	if _, err := rs.command("WATCH", stateKey, dataKey); err != nil {
+		return "", false, err
+	}
+	reply, err := rs.command("ZSCORE", rs.timeoutsKey(), member)
+	if err == nil {
+		score, _ := reply.(string)
+		expires, perr := strconv.ParseInt(score, 10, 64)
+		if reply == nil || perr != nil || expires > max {
+			_, err = rs.command("UNWATCH")
+			return "", false, err
+		}
+		reply, err = rs.command("GET", stateKey)
+	}
+	if err != nil {
+		if rs.conn != nil {
+			rs.command("UNWATCH")
+		}
+		return "", false, err
+	}
+	state, _ = reply.(string)
+
+	replies, err := rs.exec(
+		[]string{"ZREM", rs.timeoutsKey(), member},
+		[]string{"DEL", stateKey, dataKey},
+	)
+	if err != nil || replies == nil {
+		return "", false, err
+	}
+	// timeout is removed by another bot instance
+	if n, _ := replies[0].(int64); n == 0 {
+		return "", false, nil
+	}
+	return state, true, nil
+}
+
+// GetState returns empty string, if state is not set, or expired,
+// state with passed timeout is expired too, even if it is not swept yet
+func (rs *RedisStorage) GetState(cid, uid int64) (string, error) {
+	replies, err := rs.multi(
+		[]string{"GET", rs.key(cid, uid, "state")},
+		[]string{"ZSCORE", rs.timeoutsKey(), timeoutMember(cid, uid)},
+	)
+	if err != nil || replies == nil {
+		return "", err
+	}
+	if len(replies) != 2 {
+		return "", errRespSyntax
+	}
+	if score, ok := replies[1].(string); ok {
+		expires, err := strconv.ParseInt(score, 10, 64)
+		if err != nil {
+			return "", errRespSyntax
+		}
+		if expires <= time.Now().UnixNano()/int64(time.Millisecond) {
+			return "", nil
+		}
+	}
+	state, _ := replies[0].(string)
+	return state, nil
+}
+
+// Clear deletes state and data
+func (rs *RedisStorage) Clear(cid, uid int64) error {
+	_, err := rs.multi(
+		[]string{"ZREM", rs.timeoutsKey(), timeoutMember(cid, uid)},
+		[]string{"DEL", rs.key(cid, uid, "state"), rs.key(cid, uid, "data")},
+	)
+	return err
+}
+
+// migrateTimeout moves timeout of record to new chat
+func (rs *RedisStorage) migrateTimeout(from, uid, to, newUID int64) error {
+	reply, err := rs.Do("ZSCORE", rs.timeoutsKey(), timeoutMember(from, uid))
+	if err != nil || reply == nil {
+		return err
+	}
+	score, _ := reply.(string)
+	if _, err := rs.Do("ZREM", rs.timeoutsKey(), timeoutMember(from, uid)); err != nil {
+		return err
+	}
+	_, err = rs.Do("ZADD", rs.timeoutsKey(), score, timeoutMember(to, newUID))
+	return err
+}
+
+// MigrateChat renames all keys of chat to keys of new chat, ttl and timeouts are kept
+func (rs *RedisStorage) MigrateChat(from, to int64) error {
+	oldPrefix := rs.conf.Prefix + ":" + strconv.FormatInt(from, 10) + ":"
+
+	cursor := "0"
+	for {
+		reply, err := rs.Do("SCAN", cursor, "MATCH", oldPrefix+"*", "COUNT", "100")
+		if err != nil {
+			return err
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 2 {
+			return errRespSyntax
+		}
+		cursor, _ = items[0].(string)
+		keys, _ := items[1].([]interface{})
+
+		for _, k := range keys {
+			key, _ := k.(string)
+			if !strings.HasPrefix(key, oldPrefix) {
+				continue
+			}
+			rest := strings.TrimPrefix(key, oldPrefix)
+			i := strings.LastIndex(rest, ":")
+			if i < 0 {
+				continue
+			}
+			uid, err := strconv.ParseInt(rest[:i], 10, 64)
+			if err != nil {
+				// not a record of storage
+				continue
+			}
+			newUID := migratedUser(uid, from, to)
+			if _, err := rs.Do("RENAME", key, rs.key(to, newUID, rest[i+1:])); err != nil {
+				return err
+			}
+			if rest[i+1:] == "state" {
+				if err := rs.migrateTimeout(from, uid, to, newUID); err != nil {
+					return err
+				}
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// Close closes connection, stored data is kept
+func (rs *RedisStorage) Close() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.disconnect()
+}
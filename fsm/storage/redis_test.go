@@ -0,0 +1,445 @@
+package storage
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is in-process stand-in of redis server,
+// supports only commands used by RedisStorage
+type fakeRedis struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	zsets   map[string]map[string]int64
+	// versions of keys are changed by writes, uses by WATCH
+	versions map[string]int
+
+	// afterCommand is called after command, which is not in transaction,
+	// under lock of server
+	afterCommand func(args []string)
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr := &fakeRedis{
+		ln:      ln,
+		values:  map[string]string{},
+		expires: map[string]time.Time{},
+		zsets:   map[string]map[string]int64{},
+
+		versions: map[string]int{},
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fr.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return fr
+}
+
+func (fr *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+
+	// transaction of connection
+	var multi bool
+	var queue [][]string
+	watched := map[string]int{}
+	for {
+		req, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		items, _ := req.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "WATCH":
+			fr.mu.Lock()
+			for _, key := range args[1:] {
+				watched[key] = fr.versions[key]
+			}
+			fr.mu.Unlock()
+			reply = "+OK\r\n"
+		case "UNWATCH":
+			watched = map[string]int{}
+			reply = "+OK\r\n"
+		case "MULTI":
+			multi = true
+			reply = "+OK\r\n"
+		case "DISCARD":
+			multi, queue, watched = false, nil, map[string]int{}
+			reply = "+OK\r\n"
+		case "EXEC":
+			reply = fr.execMulti(queue, watched)
+			multi, queue, watched = false, nil, map[string]int{}
+		default:
+			if multi {
+				queue = append(queue, args)
+				reply = "+QUEUED\r\n"
+			} else {
+				reply = fr.exec(args)
+			}
+		}
+		conn.Write([]byte(reply))
+	}
+}
+
+// execMulti executes queued commands, if watched keys are not changed
+func (fr *fakeRedis) execMulti(queue [][]string, watched map[string]int) string {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	for key, version := range watched {
+		if fr.versions[key] != version {
+			return "*-1\r\n"
+		}
+	}
+	reply := "*" + strconv.Itoa(len(queue)) + "\r\n"
+	for _, args := range queue {
+		reply += fr.execLocked(args)
+	}
+	return reply
+}
+
+func (fr *fakeRedis) get(key string) (string, bool) {
+	if exp, ok := fr.expires[key]; ok && time.Now().After(exp) {
+		delete(fr.values, key)
+		delete(fr.expires, key)
+	}
+	v, ok := fr.values[key]
+	return v, ok
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func (fr *fakeRedis) exec(args []string) string {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	reply := fr.execLocked(args)
+	if fr.afterCommand != nil {
+		fr.afterCommand(args)
+	}
+	return reply
+}
+
+func (fr *fakeRedis) execLocked(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		fr.versions[args[1]]++
+		fr.values[args[1]] = args[2]
+		delete(fr.expires, args[1])
+		if len(args) == 5 && args[3] == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			fr.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "GET":
+		v, ok := fr.get(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := fr.get(key); ok {
+				fr.versions[key]++
+				delete(fr.values, key)
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	case "RENAME":
+		v, ok := fr.get(args[1])
+		if !ok {
+			return "-ERR no such key\r\n"
+		}
+		fr.versions[args[1]]++
+		fr.versions[args[2]]++
+		fr.values[args[2]] = v
+		delete(fr.values, args[1])
+		if exp, ok := fr.expires[args[1]]; ok {
+			fr.expires[args[2]] = exp
+			delete(fr.expires, args[1])
+		}
+		return "+OK\r\n"
+	case "SCAN":
+		prefix := strings.TrimSuffix(args[3], "*")
+		var keys []string
+		for key := range fr.values {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, bulk(key))
+			}
+		}
+		return "*2\r\n" + bulk("0") + "*" + strconv.Itoa(len(keys)) + "\r\n" + strings.Join(keys, "")
+	case "ZADD":
+		if fr.zsets[args[1]] == nil {
+			fr.zsets[args[1]] = map[string]int64{}
+		}
+		score, _ := strconv.ParseInt(args[2], 10, 64)
+		fr.versions[args[1]]++
+		fr.zsets[args[1]][args[3]] = score
+		return ":1\r\n"
+	case "ZREM":
+		if _, ok := fr.zsets[args[1]][args[2]]; !ok {
+			return ":0\r\n"
+		}
+		fr.versions[args[1]]++
+		delete(fr.zsets[args[1]], args[2])
+		return ":1\r\n"
+	case "ZSCORE":
+		score, ok := fr.zsets[args[1]][args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(strconv.FormatInt(score, 10))
+	case "ZRANGEBYSCORE":
+		max, _ := strconv.ParseInt(args[3], 10, 64)
+		var members []string
+		for member, score := range fr.zsets[args[1]] {
+			if score <= max {
+				members = append(members, bulk(member))
+			}
+		}
+		return "*" + strconv.Itoa(len(members)) + "\r\n" + strings.Join(members, "")
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *fakeRedis) {
+	fr := newFakeRedis(t)
+	rs, err := NewRedisStorage(NewRedisConfig(fr.ln.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rs.Close)
+	return rs, fr
+}
+
+func TestRedisStorage(t *testing.T) {
+	rs, fr := newTestRedisStorage(t)
+
+	if err := rs.SetState(1, 2, "group:state"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.SetData(1, 2, PackType{"name": "piko", "age": 17}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fr.values["fsm:1:2:state"]; !ok {
+		t.Fatal("key is not prefixed", fr.values)
+	}
+
+	state, err := rs.GetState(1, 2)
+	if err != nil || state != "group:state" {
+		t.Fatal("wrong state", state, err)
+	}
+	data, err := rs.GetData(1, 2)
+	if err != nil || data["name"] != "piko" || data["age"] != int64(17) {
+		t.Fatal("wrong data", data, err)
+	}
+
+	if err := rs.Clear(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	state, _ = rs.GetState(1, 2)
+	data, _ = rs.GetData(1, 2)
+	if state != "" || data != nil {
+		t.Fatal("record is not cleared", state, data)
+	}
+}
+
+func TestRedisStorageTTL(t *testing.T) {
+	rs, _ := newTestRedisStorage(t)
+	rs.conf.StateTTL = 10 * time.Millisecond
+
+	if err := rs.SetState(1, 2, "state"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if state, _ := rs.GetState(1, 2); state != "" {
+		t.Fatal("state is not expired", state)
+	}
+}
+
+func TestRedisStorageMigrateChat(t *testing.T) {
+	rs, _ := newTestRedisStorage(t)
+
+	rs.SetState(-1, 2, "state")
+	rs.SetStateTTL(-1, -1, "chat", time.Hour)
+	if err := rs.MigrateChat(-1, -100); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := rs.GetState(-100, 2); state != "state" {
+		t.Fatal("state is not migrated", state)
+	}
+	if state, _ := rs.GetState(-100, -100); state != "chat" {
+		t.Fatal("state of chat is not migrated", state)
+	}
+	if expired, _ := rs.PopExpired(time.Now().Add(2 * time.Hour)); len(expired) != 1 || expired[0].UserID != -100 {
+		t.Fatal("timeout of chat is not migrated", expired)
+	}
+	if state, _ := rs.GetState(-1, 2); state != "" {
+		t.Fatal("old state is not deleted", state)
+	}
+}
+
+func TestRedisStorageReconnect(t *testing.T) {
+	rs, _ := newTestRedisStorage(t)
+
+	rs.mu.Lock()
+	rs.conn.Close()
+	rs.mu.Unlock()
+
+	// first command fails, and closes connection
+	rs.SetState(1, 2, "state")
+	if err := rs.SetState(1, 2, "state"); err != nil {
+		t.Fatal("not reconnected", err)
+	}
+}
+
+func TestRedisStorageTimeout(t *testing.T) {
+	// server accepts connection, and never replies
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	conf := NewRedisConfig(ln.Addr().String())
+	conf.Timeout = 20 * time.Millisecond
+	rs, err := NewRedisStorage(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := rs.GetState(1, 2)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Fatal("wrong error of stalled server", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("command is blocked by stalled server")
+	}
+}
+
+func TestRedisError(t *testing.T) {
+	rs, _ := newTestRedisStorage(t)
+
+	_, err := rs.Do("PING")
+	if _, ok := err.(RedisError); !ok {
+		t.Fatal("error reply is not returned", err)
+	}
+}
+
+func TestRedisStoragePopExpired(t *testing.T) {
+	rs, _ := newTestRedisStorage(t)
+
+	rs.SetStateTTL(1, 2, "form:name", time.Millisecond)
+	rs.SetData(1, 2, PackType{"name": "piko"})
+	rs.SetStateTTL(1, 3, "form:name", time.Hour)
+	// timeout is cancelled by new state
+	rs.SetStateTTL(1, 4, "form:name", time.Millisecond)
+	rs.SetState(1, 4, "form:age")
+	rs.SetStateTTL(-1, 5, "form:name", time.Millisecond)
+	rs.MigrateChat(-1, -100)
+
+	expired, err := rs.PopExpired(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 2 {
+		t.Fatal("wrong expired records", expired)
+	}
+	for _, e := range expired {
+		if e.State != "form:name" || (e.ChatID != 1 && e.ChatID != -100) {
+			t.Fatal("wrong expired record", e)
+		}
+	}
+	if data, _ := rs.GetData(1, 2); data != nil {
+		t.Fatal("expired record is not cleared", data)
+	}
+	if expired, _ := rs.PopExpired(time.Now().Add(time.Second)); len(expired) != 0 {
+		t.Fatal("expired record is returned twice", expired)
+	}
+}
+
+func TestRedisStorageExpiredState(t *testing.T) {
+	rs, _ := newTestRedisStorage(t)
+
+	rs.SetStateTTL(1, 2, "form:name", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if state, err := rs.GetState(1, 2); err != nil || state != "" {
+		t.Fatal("expired state is returned", state, err)
+	}
+	// state is still kept for sweeper
+	expired, _ := rs.PopExpired(time.Now())
+	if len(expired) != 1 || expired[0].State != "form:name" {
+		t.Fatal("wrong expired records", expired)
+	}
+}
+
+func TestRedisStoragePopExpiredRace(t *testing.T) {
+	rs, fr := newTestRedisStorage(t)
+
+	rs.SetStateTTL(1, 2, "form:name", time.Millisecond)
+	// handler sets new state, after sweeper has read expired one
+	fr.mu.Lock()
+	fr.afterCommand = func(args []string) {
+		if args[0] == "GET" && args[1] == "fsm:1:2:state" {
+			fr.afterCommand = nil
+			fr.versions[args[1]]++
+			fr.values[args[1]] = "form:age"
+			delete(fr.zsets["fsm:timeouts"], "1:2")
+		}
+	}
+	fr.mu.Unlock()
+
+	expired, err := rs.PopExpired(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 0 {
+		t.Fatal("changed record is returned", expired)
+	}
+	if state, _ := rs.GetState(1, 2); state != "form:age" {
+		t.Fatal("new state is deleted by sweeper", state)
+	}
+}
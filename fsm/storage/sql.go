@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Placeholder is style of query parameters of sql driver
+type Placeholder int
+
+const (
+	// QuestionPlaceholder is ? style, uses by sqlite and mysql
+	QuestionPlaceholder Placeholder = iota
+	// DollarPlaceholder is $1 style, uses by postgres
+	DollarPlaceholder
+)
+
+// SQLConfig is configuration of SQLStorage
+type SQLConfig struct {
+	// Table is name of table, default is "fsm_states"
+	// it is inserted to queries as is, so must not be taken from users
+	Table       string
+	Placeholder Placeholder
+}
+
+// NewSQLConfig returns config with default table name
+func NewSQLConfig(placeholder Placeholder) *SQLConfig {
+	return &SQLConfig{
+		Table:       "fsm_states",
+		Placeholder: placeholder,
+	}
+}
+
+// SQLStorage stores states and data in sql database, using database/sql
+// Data is serialized to json, table is created by Migrate
+//
+// Queries use INSERT ... ON CONFLICT for upsert,
+// which is supported by postgres and sqlite
+// Timeouts of states are kept in expires_at column as unix milliseconds
+type SQLStorage struct {
+	db   *sql.DB
+	conf *SQLConfig
+}
+
+// NewSQLStorage returns storage, which uses db,
+// Migrate should be called before usage
+func NewSQLStorage(db *sql.DB, conf *SQLConfig) *SQLStorage {
+	if conf.Table == "" {
+		conf.Table = "fsm_states"
+	}
+	return &SQLStorage{db: db, conf: conf}
+}
+
+// query replaces ? placeholders, and table name in query
+func (s *SQLStorage) query(q string) string {
+	q = strings.Replace(q, "{table}", s.conf.Table, -1)
+	if s.conf.Placeholder != DollarPlaceholder {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Migrate creates table if not exists
+func (s *SQLStorage) Migrate() error {
+	_, err := s.db.Exec(s.query(`CREATE TABLE IF NOT EXISTS {table} (
+	chat_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	state TEXT NOT NULL DEFAULT '',
+	data JSONB,
+	updated_at TIMESTAMP NOT NULL,
+	expires_at BIGINT,
+	PRIMARY KEY (chat_id, user_id)
+)`))
+	return err
+}
+
+// SetData serializes data to json, and upserts it
+func (s *SQLStorage) SetData(cid, uid int64, data PackType) error {
+	var value interface{}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		value = string(b)
+	}
+	_, err := s.db.Exec(s.query(`INSERT INTO {table} (chat_id, user_id, data, updated_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (chat_id, user_id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`),
+		cid, uid, value, time.Now().UTC())
+	return err
+}
+
+// GetData returns nil, if data is not set
+func (s *SQLStorage) GetData(cid, uid int64) (PackType, error) {
+	var value []byte
+	err := s.db.QueryRow(s.query(`SELECT data FROM {table} WHERE chat_id = ? AND user_id = ?`), cid, uid).Scan(&value)
+	if err == sql.ErrNoRows || (err == nil && value == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodePack(value)
+}
+
+// SetState upserts state, timeout of previous state is cancelled
+func (s *SQLStorage) SetState(cid, uid int64, state string) error {
+	return s.setState(cid, uid, state, nil)
+}
+
+// SetStateTTL upserts state, which expires after ttl
+func (s *SQLStorage) SetStateTTL(cid, uid int64, state string, ttl time.Duration) error {
+	return s.setState(cid, uid, state, unixMillis(time.Now().Add(ttl)))
+}
+
+func (s *SQLStorage) setState(cid, uid int64, state string, expires interface{}) error {
+	_, err := s.db.Exec(s.query(`INSERT INTO {table} (chat_id, user_id, state, updated_at, expires_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (chat_id, user_id) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at, expires_at = excluded.expires_at`),
+		cid, uid, state, time.Now().UTC(), expires)
+	return err
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// GetState returns empty string, if state is not set, or expired
+func (s *SQLStorage) GetState(cid, uid int64) (string, error) {
+	var state string
+	err := s.db.QueryRow(s.query(`SELECT state FROM {table} WHERE chat_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)`),
+		cid, uid, unixMillis(time.Now())).Scan(&state)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return state, err
+}
+
+// PopExpired deletes records with expired states, record is returned,
+// only if this call deleted it, so several bot instances
+// do not handle same timeout
+func (s *SQLStorage) PopExpired(now time.Time) ([]ExpiredRecord, error) {
+	max := unixMillis(now)
+	rows, err := s.db.Query(s.query(`SELECT chat_id, user_id, state FROM {table} WHERE expires_at <= ?`), max)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []ExpiredRecord
+	for rows.Next() {
+		var r ExpiredRecord
+		if err := rows.Scan(&r.ChatID, &r.UserID, &r.State); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredRecord
+	for _, r := range candidates {
+		res, err := s.db.Exec(s.query(`DELETE FROM {table} WHERE chat_id = ? AND user_id = ? AND expires_at <= ?`),
+			r.ChatID, r.UserID, max)
+		if err != nil {
+			return expired, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			expired = append(expired, r)
+		}
+	}
+	return expired, nil
+}
+
+// Clear deletes state and data
+func (s *SQLStorage) Clear(cid, uid int64) error {
+	_, err := s.db.Exec(s.query(`DELETE FROM {table} WHERE chat_id = ? AND user_id = ?`), cid, uid)
+	return err
+}
+
+// MigrateChat moves all records from chat to new chat,
+// records of new chat with same users are replaced
+func (s *SQLStorage) MigrateChat(from, to int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	// records of new chat, which are overwritten by migrated ones
+	_, err = tx.Exec(s.query(`DELETE FROM {table} WHERE chat_id = ? AND user_id IN (
+		SELECT CASE WHEN user_id = ? THEN ? ELSE user_id END FROM {table} WHERE chat_id = ?)`), to, from, to, from)
+	if err == nil {
+		_, err = tx.Exec(s.query(`UPDATE {table} SET chat_id = ?, user_id = CASE WHEN user_id = ? THEN ? ELSE user_id END WHERE chat_id = ?`), to, from, to, from)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close does nothing, db is not closed, because it is usually shared
+func (s *SQLStorage) Close() {}
@@ -0,0 +1,132 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestSQLStorage(t *testing.T) *SQLStorage {
+	db, err := sql.Open("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s := NewSQLStorage(db, NewSQLConfig(QuestionPlaceholder))
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	// second migration must not fail
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLStorage(t *testing.T) {
+	s := newTestSQLStorage(t)
+
+	if state, err := s.GetState(1, 2); err != nil || state != "" {
+		t.Fatal("state of new record", state, err)
+	}
+	if err := s.SetState(1, 2, "group:state"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetData(1, 2, PackType{"name": "piko"}); err != nil {
+		t.Fatal(err)
+	}
+	// state is not overwritten by data upsert
+	if state, err := s.GetState(1, 2); err != nil || state != "group:state" {
+		t.Fatal("wrong state", state, err)
+	}
+	if data, err := s.GetData(1, 2); err != nil || data["name"] != "piko" {
+		t.Fatal("wrong data", data, err)
+	}
+
+	if err := s.Clear(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := s.GetData(1, 2); err != nil || data != nil {
+		t.Fatal("data is not cleared", data, err)
+	}
+}
+
+func TestSQLStorageConcurrentUpsert(t *testing.T) {
+	s := newTestSQLStorage(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.SetState(1, 2, "state"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if state, _ := s.GetState(1, 2); state != "state" {
+		t.Fatal("wrong state", state)
+	}
+}
+
+func TestSQLStorageMigrateChat(t *testing.T) {
+	s := newTestSQLStorage(t)
+
+	s.SetState(-1, 2, "old")
+	s.SetState(-100, 2, "stale")
+	s.SetState(-1, -1, "chat")
+	s.SetState(-100, -100, "stale chat")
+	if err := s.MigrateChat(-1, -100); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := s.GetState(-100, 2); state != "old" {
+		t.Fatal("state is not migrated", state)
+	}
+	if state, _ := s.GetState(-100, -100); state != "chat" {
+		t.Fatal("state of chat is not migrated", state)
+	}
+}
+
+func TestDollarPlaceholder(t *testing.T) {
+	s := NewSQLStorage(nil, NewSQLConfig(DollarPlaceholder))
+	q := s.query("SELECT state FROM {table} WHERE chat_id = ? AND user_id = ?")
+	if q != "SELECT state FROM fsm_states WHERE chat_id = $1 AND user_id = $2" {
+		t.Fatal("wrong query", q)
+	}
+}
+
+func TestSQLStoragePopExpired(t *testing.T) {
+	s := newTestSQLStorage(t)
+
+	s.SetStateTTL(1, 2, "form:name", time.Millisecond)
+	s.SetData(1, 2, PackType{"name": "piko"})
+	s.SetStateTTL(1, 3, "form:name", time.Hour)
+	s.SetStateTTL(1, 4, "form:name", time.Millisecond)
+	s.SetState(1, 4, "form:age")
+
+	time.Sleep(5 * time.Millisecond)
+	if state, _ := s.GetState(1, 2); state != "" {
+		t.Fatal("expired state is returned", state)
+	}
+	expired, err := s.PopExpired(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0] != (ExpiredRecord{ChatID: 1, UserID: 2, State: "form:name"}) {
+		t.Fatal("wrong expired records", expired)
+	}
+	if data, _ := s.GetData(1, 2); data != nil {
+		t.Fatal("expired record is not deleted", data)
+	}
+	if state, _ := s.GetState(1, 4); state != "form:age" {
+		t.Fatal("timeout is not cancelled", state)
+	}
+}
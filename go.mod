@@ -2,4 +2,7 @@ module github.com/pikoUsername/tgp
 
 go 1.15
 
-require github.com/pikoUsername/MultipartReader v0.0.0-20220503172724-5bf1593475e1
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/pikoUsername/MultipartReader v0.0.0-20220503172724-5bf1593475e1
+)
@@ -8,6 +8,20 @@ import (
 
 type HandlerFunc func(*Context)
 
+// HandlerFuncErr is handler, which returns error,
+// returned error goes to Dispatcher.OnError handlers
+type HandlerFuncErr func(*Context) error
+
+// WithError adapts HandlerFuncErr to HandlerFunc,
+// returned error is added to Context errors, and handler chain is aborted
+func WithError(h HandlerFuncErr) HandlerFunc {
+	return func(ctx *Context) {
+		if err := h(ctx); err != nil {
+			ctx.AbortWithError(err)
+		}
+	}
+}
+
 // Another level of abstraction
 // Filters field is Filter interface
 // func(u *objects.Update) and Filter interface
@@ -48,6 +62,12 @@ func (he *HandlerType) Command(cmd string) *HandlerType {
 	return he
 }
 
+// CallbackData register callback data filter
+func (he *HandlerType) CallbackData(cd *filters.CallbackData, conditions map[string]string) *HandlerType {
+	he.filters = append(he.filters, cd.Filter(conditions))
+	return he
+}
+
 // GetFilters returns filters interfaces, types tgp.FilterFunc, tgp.Filter
 func (he *HandlerType) GetFilters() []Filter {
 	return he.filters
@@ -93,12 +113,15 @@ func NewHandlerType(handler HandlerFunc) *HandlerType {
 type HandlerChain interface {
 	Trigger(*Context)
 	HandlerFunc(HandlerFunc) *HandlerType
+	Handle(HandlerFuncErr) *HandlerType
 	Handlers() []HandlerFunc
 	Use(md ...MiddlewareFunc)
+	UseOuter(md ...MiddlewareFunc)
 }
 
 type DefaultHandlerChain struct {
 	middleware []MiddlewareFunc
+	outer      []MiddlewareFunc
 	handlers   []*HandlerType
 	mu         sync.Mutex
 }
@@ -117,27 +140,36 @@ func (ho *DefaultHandlerChain) Handlers() []HandlerFunc {
 	return l
 }
 
+// Trigger calls outer middlewares, and first handler which filters is passed,
+// wrapped by inner middlewares of routers and chain
 func (ho *DefaultHandlerChain) Trigger(c *Context) {
+	wrapMiddlewares(ho.trigger, ho.outer)(c)
+}
+
+func (ho *DefaultHandlerChain) trigger(c *Context) {
 	c.handlers = ho.handlers
 	for i, h := range ho.handlers {
-		if len(h.filters) == 0 || checkFilters(h.filters, c.Update) {
-			if len(ho.middleware) > 0 {
-				for _, md := range ho.middleware {
-					md(h.handler)(c)
-				}
-			} else {
-				h.handler(c)
-			}
+		if len(h.filters) == 0 || checkFilters(h.filters, c) {
+			c.handled = true
+			handler := wrapMiddlewares(h.handler, ho.middleware)
+			wrapMiddlewares(handler, c.middlewares)(c)
 			c.cursor = i
 			break
 		}
 	}
 }
 
+// Use registers inner middlewares, which wraps matched handler
 func (ho *DefaultHandlerChain) Use(md ...MiddlewareFunc) {
 	ho.middleware = append(ho.middleware, md...)
 }
 
+// UseOuter registers outer middlewares,
+// which are called for every update of chain type before filters
+func (ho *DefaultHandlerChain) UseOuter(md ...MiddlewareFunc) {
+	ho.outer = append(ho.outer, md...)
+}
+
 // HandlerFunc appends new handlerType, and returns it
 func (ho *DefaultHandlerChain) HandlerFunc(h HandlerFunc) *HandlerType {
 	handler := &HandlerType{handler: h}
@@ -145,16 +177,31 @@ func (ho *DefaultHandlerChain) HandlerFunc(h HandlerFunc) *HandlerType {
 	return handler
 }
 
+// Handle same as HandlerFunc, but handler returns error
+func (ho *DefaultHandlerChain) Handle(h HandlerFuncErr) *HandlerType {
+	return ho.HandlerFunc(WithError(h))
+}
+
 // for later usages in experimental versions...
 type AllHandlerTypes struct {
-	MessageHandler         HandlerChain
-	CallbackQueryHandler   HandlerChain
-	ChannelPostHandler     HandlerChain
-	PollHandler            HandlerChain
-	ChatMemberHandler      HandlerChain
-	PollAnswerHandler      HandlerChain
-	MyChatMemberHandler    HandlerChain
-	ChatJoinRequestHandler HandlerChain
+	MessageHandler           HandlerChain
+	EditedMessageHandler     HandlerChain
+	CallbackQueryHandler     HandlerChain
+	ChannelPostHandler       HandlerChain
+	EditedChannelPostHandler HandlerChain
+	PollHandler              HandlerChain
+	ChatMemberHandler        HandlerChain
+	PollAnswerHandler        HandlerChain
+	MyChatMemberHandler      HandlerChain
+	ChatJoinRequestHandler   HandlerChain
+
+	// inline mode
+	InlineQueryHandler        HandlerChain
+	ChosenInlineResultHandler HandlerChain
+
+	// payments
+	ShippingQueryHandler    HandlerChain
+	PreCheckoutQueryHandler HandlerChain
 }
 
 func newHandlerTypes() *AllHandlerTypes {
@@ -163,10 +210,17 @@ func newHandlerTypes() *AllHandlerTypes {
 	r.MessageHandler = NewHandlerChain()
 	r.CallbackQueryHandler = NewHandlerChain()
 	r.ChannelPostHandler = NewHandlerChain()
+	r.EditedMessageHandler = NewHandlerChain()
+	r.EditedChannelPostHandler = NewHandlerChain()
 	r.ChatMemberHandler = NewHandlerChain()
 	r.PollHandler = NewHandlerChain()
 	r.PollAnswerHandler = NewHandlerChain()
-	r.ChannelPostHandler = NewHandlerChain()
+	r.MyChatMemberHandler = NewHandlerChain()
+	r.ChatJoinRequestHandler = NewHandlerChain()
+	r.InlineQueryHandler = NewHandlerChain()
+	r.ChosenInlineResultHandler = NewHandlerChain()
+	r.ShippingQueryHandler = NewHandlerChain()
+	r.PreCheckoutQueryHandler = NewHandlerChain()
 
 	return r
 }
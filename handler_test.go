@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/pikoUsername/tgp/filters"
+	"github.com/pikoUsername/tgp/fsm"
 	"github.com/pikoUsername/tgp/objects"
 )
 
@@ -50,6 +51,18 @@ func TestRegister(t *testing.T) {
 	}
 }
 
+// messageUpdate returns update with text message from user 2 in private chat
+func messageUpdate(id, chatID int64, text string) *objects.Update {
+	return &objects.Update{
+		UpdateID: id,
+		Message: &objects.Message{
+			Text: text,
+			Chat: &objects.Chat{ID: chatID, Type: "private"},
+			From: &objects.User{ID: 2},
+		},
+	}
+}
+
 func TestHandlerTrigger(t *testing.T) {
 	dp, err := GetDispatcher(false)
 	if err != nil {
@@ -90,3 +103,49 @@ func BenchmarkTriggerHandler(b *testing.B) {
 		dp.MessageHandler.Trigger(c)
 	}
 }
+
+func TestHandlerCallbackValues(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vote := filters.NewCallbackData("vote", "action", "id")
+
+	var values filters.CallbackValues
+	dp.CallbackQueryHandler.HandlerFunc(func(ctx *Context) {
+		t.Fatal("handler with failed filter is called")
+	}).CallbackData(vote, map[string]string{"action": "down"})
+	dp.CallbackQueryHandler.HandlerFunc(func(ctx *Context) {
+		values = ctx.CallbackValues()
+	}).CallbackData(vote, nil)
+
+	data, _ := vote.New("up", 42)
+	dp.ProcessOneUpdate(&objects.Update{CallbackQuery: &objects.CallbackQuery{
+		Data: data, From: &objects.User{ID: 1},
+	}})
+	if id, _ := values.Int("id"); values["action"] != "up" || id != 42 {
+		t.Fatal("callback data is not passed to handler", values)
+	}
+}
+
+func TestHandlerStateFilterKeyStrategy(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.KeyStrategy = fsm.ChatKey
+	chat := &objects.Chat{ID: 1}
+	menu := fsm.NewState("menu")
+
+	var called bool
+	// filter is built without dispatcher, and uses its KeyStrategy
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		called = true
+	}).Filters(filters.StateFilter(menu, dp.Storage))
+
+	dp.Context(&objects.Update{Message: &objects.Message{Chat: chat, From: &objects.User{ID: 2}}}).SetState(menu)
+	dp.ProcessOneUpdate(&objects.Update{Message: &objects.Message{Chat: chat, From: &objects.User{ID: 3}}})
+	if !called {
+		t.Fatal("state filter does not use KeyStrategy of dispatcher")
+	}
+}
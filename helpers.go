@@ -77,26 +77,6 @@ func FormatMarkup(obj interface{}) string {
 	return ""
 }
 
-func extractIds(u *objects.Update) (cid_, uid_ int64) {
-	var cid, uid int64
-
-	if u.Message != nil {
-		cid = u.Message.Chat.ID
-		uid = u.Message.From.ID
-	} else if u.EditedMessage != nil {
-		cid = u.EditedMessage.Chat.ID
-		uid = u.EditedMessage.From.ID
-	} else if u.Message.PinnedMessage != nil {
-		cid = u.Message.PinnedMessage.Chat.ID
-		uid = u.Message.PinnedMessage.From.ID
-	} else if u.Message.ReplyToMessage != nil {
-		cid = u.Message.ReplyToMessage.Chat.ID
-		uid = u.Message.ReplyToMessage.From.ID
-	}
-
-	return cid, uid
-}
-
 func requestToUpdate(req *http.Request) (*objects.Update, error) {
 	if req.Method != http.MethodPost {
 		return nil, tgpErr.New("wrong HTTP method required POST")
@@ -172,11 +152,7 @@ func checkResult(resp *objects.TelegramResponse) (*objects.TelegramResponse, err
 		if resp.Parametrs != nil {
 			parameters = *resp.Parametrs
 		}
-		return resp, &objects.TelegramApiError{
-			Code:               resp.ErrorCode,
-			Description:        resp.Description,
-			ResponseParameters: parameters,
-		}
+		return resp, objects.NewTelegramApiError(resp.ErrorCode, resp.Description, parameters)
 	}
 
 	return resp, nil
@@ -1,8 +1,11 @@
 package tgp
 
 import (
+	"errors"
 	"net/url"
 	"testing"
+
+	"github.com/pikoUsername/tgp/objects"
 )
 
 // go test -v
@@ -21,3 +24,26 @@ func TestUrlvaluesToMapString(t *testing.T) {
 		t.Fatal("value is not correct, converting value is not working")
 	}
 }
+
+func TestCheckResultErrors(t *testing.T) {
+	_, err := checkResult(&objects.TelegramResponse{
+		ErrorCode:   403,
+		Description: "Forbidden: bot was blocked by the user",
+	})
+	if !errors.Is(err, objects.ErrBotBlocked) || !errors.Is(err, objects.ErrForbidden) {
+		t.Fatal("error is not matched", err)
+	}
+	if errors.Is(err, objects.ErrChatNotFound) {
+		t.Fatal("error is matched by wrong kind")
+	}
+
+	_, err = checkResult(&objects.TelegramResponse{
+		ErrorCode:   429,
+		Description: "Too Many Requests: retry after 5",
+		Parametrs:   &objects.ResponseParameters{RetryAfter: 5},
+	})
+	var apiErr *objects.TelegramApiError
+	if !errors.Is(err, objects.ErrTooManyRequests) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 5 {
+		t.Fatal("too many requests error is not matched", err)
+	}
+}
@@ -1,4 +1,22 @@
 package tgp
 
-// MiddlewareFunc
+// MiddlewareFunc wraps handler, there are two phases of middlewares:
+//
+// Inner middlewares (Use) wraps only matched handler,
+// they are not called if no one handler passed filters
+//
+// Outer middlewares (UseOuter) are called for every update before filters,
+// next handler is filters checking and handlers calling,
+// so outer middleware can skip update by not calling next, e.g for throttling
+//
+// Middlewares of chain are scoped by update type of chain,
+// middlewares of router, or dispatcher applies to all update types
 type MiddlewareFunc func(HandlerFunc) HandlerFunc
+
+// wrapMiddlewares wraps h, first middleware is outermost
+func wrapMiddlewares(h HandlerFunc, mds []MiddlewareFunc) HandlerFunc {
+	for i := len(mds) - 1; i >= 0; i-- {
+		h = mds[i](h)
+	}
+	return h
+}
@@ -0,0 +1,85 @@
+package tgp
+
+import (
+	"testing"
+)
+
+func recordMiddleware(calls *[]string, name string) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			*calls = append(*calls, name)
+			next(ctx)
+		}
+	}
+}
+
+func TestInnerMiddlewareCalledOnce(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	dp.MessageHandler.Use(recordMiddleware(&calls, "first"), recordMiddleware(&calls, "second"))
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		calls = append(calls, "handler")
+	}).Command("start")
+
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "/start")); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 || calls[0] != "first" || calls[1] != "second" || calls[2] != "handler" {
+		t.Fatal("wrong calls", calls)
+	}
+
+	// inner middlewares is not called for not matched update
+	calls = nil
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatal("inner middleware called without handler", calls)
+	}
+}
+
+func TestOuterMiddleware(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	dp.UseOuter(recordMiddleware(&calls, "dispatcher"))
+	dp.Use(recordMiddleware(&calls, "inner"))
+	dp.MessageHandler.UseOuter(recordMiddleware(&calls, "message"))
+	dp.CallbackQueryHandler.UseOuter(recordMiddleware(&calls, "callback"))
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		calls = append(calls, "handler")
+	}).Command("start")
+
+	// outer middlewares are called even if update is not handled
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "dispatcher" || calls[1] != "message" {
+		t.Fatal("wrong calls", calls)
+	}
+
+	calls = nil
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "/start")); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 4 || calls[2] != "inner" || calls[3] != "handler" {
+		t.Fatal("wrong calls", calls)
+	}
+
+	// outer middleware can skip update
+	dp.UseOuter(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {}
+	})
+	calls = nil
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "/start")); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != "dispatcher" {
+		t.Fatal("update is not skipped", calls)
+	}
+}
@@ -7,7 +7,7 @@ type CallbackQuery struct {
 	ID              string   `json:"id"`
 	From            *User    `json:"from"`
 	Message         *Message `json:"message"`
-	InlineMessageID int64    `json:"inline_message_id"`
+	InlineMessageID string   `json:"inline_message_id"`
 	ChatInstance    string   `json:"chat_instance"`
 	Data            string   `json:"data"`
 	GameShortName   string   `json:"game_short_name"`
@@ -3,7 +3,7 @@ package objects
 // ChosenInlineResult represents ChosenInlineResult object
 // https://core.telegram.org/bots/api#choseninlineresult
 type ChosenInlineResult struct {
-	ResultID        int64     `json:"result_id"`
+	ResultID        string    `json:"result_id"`
 	From            *User     `json:"from"`
 	Location        *Location `json:"location"`
 	InlineMessageID string    `json:"inline_message_id"`
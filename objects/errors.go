@@ -1,7 +1,9 @@
 package objects
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 )
 
 // Represents Telegram ResponseParameters object
@@ -16,16 +18,134 @@ type ResponseParameters struct {
 // not correct
 // see: https://github.com/TelegramBotAPI/errors
 // official docs: https://core.telegram.org/api/errors
+//
+// TelegramApiError works with errors.Is, and sentinel errors below
+// if errors.Is(err, objects.ErrBotBlocked) { ... }
 type TelegramApiError struct {
 	Code        uint
 	Description string
 	ResponseParameters
+
+	// Kind is sentinel error which matched by Description
+	Kind error
 }
 
 func (e *TelegramApiError) Error() string {
 	return fmt.Sprintf("telegram: %s", e.Description)
 }
 
+// Unwrap returns Kind of error
+func (e *TelegramApiError) Unwrap() error {
+	return e.Kind
+}
+
+// Is matches error by code, for example ErrBadRequest matches all 400 errors
+func (e *TelegramApiError) Is(target error) bool {
+	if target == nil {
+		return false
+	}
+	if e.MigrateToChatID != 0 && target == ErrMigrateToChat {
+		return true
+	}
+	return target == codeError(e.Code)
+}
+
+// NewTelegramApiError creates error, and resolves Kind of it
+func NewTelegramApiError(code uint, description string, params ResponseParameters) *TelegramApiError {
+	e := &TelegramApiError{
+		Code:               code,
+		Description:        description,
+		ResponseParameters: params,
+	}
+	desc := strings.ToLower(description)
+	for _, m := range descriptionErrors {
+		if strings.Contains(desc, m.text) {
+			e.Kind = m.err
+			break
+		}
+	}
+	return e
+}
+
+// Errors by error code
+var (
+	ErrBadRequest      = errors.New("telegram: bad request")
+	ErrUnauthorized    = errors.New("telegram: unauthorized")
+	ErrForbidden       = errors.New("telegram: forbidden")
+	ErrNotFound        = errors.New("telegram: not found")
+	ErrConflict        = errors.New("telegram: conflict")
+	ErrTooManyRequests = errors.New("telegram: too many requests")
+	ErrServerError     = errors.New("telegram: server error")
+)
+
+// Errors by error description
+var (
+	ErrBotBlocked               = errors.New("telegram: bot was blocked by the user")
+	ErrBotKicked                = errors.New("telegram: bot was kicked")
+	ErrUserDeactivated          = errors.New("telegram: user is deactivated")
+	ErrCantInitiateConversation = errors.New("telegram: bot can't initiate conversation with a user")
+	ErrChatNotFound             = errors.New("telegram: chat not found")
+	ErrUserNotFound             = errors.New("telegram: user not found")
+	ErrMessageNotModified       = errors.New("telegram: message is not modified")
+	ErrMessageToEditNotFound    = errors.New("telegram: message to edit not found")
+	ErrMessageToDeleteNotFound  = errors.New("telegram: message to delete not found")
+	ErrMessageCantBeEdited      = errors.New("telegram: message can't be edited")
+	ErrMessageCantBeDeleted     = errors.New("telegram: message can't be deleted")
+	ErrReplyMessageNotFound     = errors.New("telegram: replied message not found")
+	ErrMessageTextEmpty         = errors.New("telegram: message text is empty")
+	ErrMessageTooLong           = errors.New("telegram: message is too long")
+	ErrCantParseEntities        = errors.New("telegram: can't parse entities")
+	ErrNotEnoughRights          = errors.New("telegram: not enough rights")
+	ErrInvalidQueryID           = errors.New("telegram: query is too old or query id is invalid")
+	ErrMigrateToChat            = errors.New("telegram: group chat was upgraded to a supergroup chat")
+)
+
+// descriptionErrors order matters, first matched error will be used
+var descriptionErrors = []struct {
+	text string
+	err  error
+}{
+	{"bot was blocked by the user", ErrBotBlocked},
+	{"bot was kicked", ErrBotKicked},
+	{"user is deactivated", ErrUserDeactivated},
+	{"bot can't initiate conversation", ErrCantInitiateConversation},
+	{"chat not found", ErrChatNotFound},
+	{"user not found", ErrUserNotFound},
+	{"message is not modified", ErrMessageNotModified},
+	{"message to edit not found", ErrMessageToEditNotFound},
+	{"message to delete not found", ErrMessageToDeleteNotFound},
+	{"message can't be edited", ErrMessageCantBeEdited},
+	{"message can't be deleted", ErrMessageCantBeDeleted},
+	{"replied message not found", ErrReplyMessageNotFound},
+	{"message text is empty", ErrMessageTextEmpty},
+	{"message is too long", ErrMessageTooLong},
+	{"can't parse entities", ErrCantParseEntities},
+	{"not enough rights", ErrNotEnoughRights},
+	{"query is too old", ErrInvalidQueryID},
+	{"query id is invalid", ErrInvalidQueryID},
+	{"group chat was upgraded to a supergroup", ErrMigrateToChat},
+}
+
+func codeError(code uint) error {
+	switch {
+	case code == 400:
+		return ErrBadRequest
+	case code == 401:
+		return ErrUnauthorized
+	case code == 403:
+		return ErrForbidden
+	case code == 404:
+		return ErrNotFound
+	case code == 409:
+		return ErrConflict
+	case code == 429:
+		return ErrTooManyRequests
+	case code >= 500:
+		return ErrServerError
+	}
+	return nil
+}
+
 // ErrorPrefix get to user/client
 // a error with prefix and splited up with separator
 // used in errors variable, lol
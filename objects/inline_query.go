@@ -6,10 +6,12 @@ package objects
 // location	Location	Optional. Sender location, only for bots that request user location
 // query	String	Text of the query (up to 256 characters)
 // offset	String	Offset of the results to be returned, can be controlled by the bot
+// chat_type	String	Optional. Type of the chat from which the inline query was sent
 type InlineQuery struct {
 	Id       string    `json:"id"`
 	From     *User     `json:"from"`
-	Location *Location `json:"Location"`
+	Location *Location `json:"location"`
 	Query    string    `json:"query"`
 	Offset   string    `json:"offset"`
+	ChatType string    `json:"chat_type"`
 }
@@ -11,6 +11,10 @@ type Message struct {
 	// MessageId ...
 	MessageID int64 `json:"message_id"`
 
+	// MessageThreadID is id of forum topic, uses if IsTopicMessage is true
+	MessageThreadID int64 `json:"message_thread_id"`
+	IsTopicMessage  bool  `json:"is_topic_message"`
+
 	// oops...
 	Date int64 `json:"date"`
 
@@ -61,7 +65,10 @@ type Message struct {
 	// Voice     *Voice       `json:"voice"`
 
 	ConnectedWebsite string `json:"connected_website"`
-	// Invoice *Invoice `json:"invoice"`
+
+	// Payments
+	Invoice           *Invoice           `json:"invoice"`
+	SuccessfulPayment *SuccessfulPayment `json:"successful_payment"`
 
 	// Uses when user send message with photo
 	Caption string `json:"caption"`
@@ -75,17 +82,33 @@ type Message struct {
 	NewChatPhoto   []*PhotoSize  `json:"new_chat_photo"`
 	LeftChatMember *User         `json:"left_chat_member"`
 
+	// Group migration to supergroup
+	MigrateToChatID   int64 `json:"migrate_to_chat_id"`
+	MigrateFromChatID int64 `json:"migrate_from_chat_id"`
+
 	WebAppData *WebAppData `json:"web_app_data"`
 }
 
+// Content types of message, uses in ContentType filter
+const (
+	ContentTypeText              = "TEXT"
+	ContentTypeAnimation         = "ANIMATION"
+	ContentTypeInvoice           = "INVOICE"
+	ContentTypeSuccessfulPayment = "SUCCESSFUL_PAYMENT"
+	ContentTypeUnknown           = "UNKNOWN"
+)
+
 func (m *Message) GetContentType() string {
-	// ContentTypes from utils/ can not be used bc cycle import
 	if m.Text != "" {
-		return "TEXT"
+		return ContentTypeText
 	} else if m.Animation != nil {
-		return "ANIMATION"
+		return ContentTypeAnimation
+	} else if m.Invoice != nil {
+		return ContentTypeInvoice
+	} else if m.SuccessfulPayment != nil {
+		return ContentTypeSuccessfulPayment
 	} else {
-		return "UNKNOWN"
+		return ContentTypeUnknown
 	}
 }
 
@@ -14,10 +14,11 @@ type Update struct {
 	ChosenInlineResult *ChosenInlineResult `json:"chosen_inline_result"`
 	CallbackQuery      *CallbackQuery      `json:"callback_query"`
 	ShippingQuery      *ShippingQuery      `json:"shipping_query"`
+	PreCheckoutQuery   *PreCheckoutQuery   `json:"pre_checkout_query"`
 	Poll               *Poll               `json:"poll"`
 	PollAnswer         *PollAnswer         `json:"poll_answer"`
 	MyChatMember       *ChatMemberUpdated  `json:"my_chat_member"`
-	ChatMember         *ChatMember         `json:"chat_member"`
+	ChatMember         *ChatMemberUpdated  `json:"chat_member"`
 	Date               time.Duration       `json:"date"`
 	ForwardFrom        *User               `json:"forward_from"`
 	ForwardDate        time.Duration       `json:"forward_date"`
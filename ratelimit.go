@@ -0,0 +1,214 @@
+package tgp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter throttles outgoing requests,
+// Wait blocks until request with method to chatID can be sent
+// chatID is empty, when request has not chat_id parameter
+type Limiter interface {
+	Wait(ctx context.Context, method string, chatID string) error
+}
+
+// SendMethods is methods which counted by RateLimiter as message sending
+var SendMethods = map[string]bool{
+	"sendMessage":    true,
+	"forwardMessage": true,
+	"copyMessage":    true,
+	"sendPhoto":      true,
+	"sendAudio":      true,
+	"sendDocument":   true,
+	"sendVideo":      true,
+	"sendAnimation":  true,
+	"sendVoice":      true,
+	"sendVideoNote":  true,
+	"sendMediaGroup": true,
+	"sendLocation":   true,
+	"sendVenue":      true,
+	"sendContact":    true,
+	"sendPoll":       true,
+	"sendDice":       true,
+	"sendSticker":    true,
+	"sendGame":       true,
+	"sendInvoice":    true,
+}
+
+// LimiterStats is snapshot of RateLimiter queues
+type LimiterStats struct {
+	// Waiting is count of requests which waits for a send
+	Waiting int
+	// Chats is count of waiting requests per chat_id
+	Chats map[string]int
+}
+
+// RateLimiter is token bucket limiter, with global and per chat buckets
+// Telegram allows about 30 messages per second globally,
+// 1 message per second in private chat, and 20 messages per minute in group
+// see: https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+type RateLimiter struct {
+	// Methods is methods which is throttled, other methods passes instantly
+	Methods map[string]bool
+
+	// Rates in requests per second
+	GlobalRate  float64
+	PrivateRate float64
+	GroupRate   float64
+
+	// MaxChats is count of chat buckets, after which idle buckets is removed
+	MaxChats int
+
+	global    *bucket
+	chats     map[string]*bucket
+	waiting   map[string]int
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewRateLimiter returns limiter with telegram limits
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		Methods:     SendMethods,
+		GlobalRate:  30,
+		PrivateRate: 1,
+		GroupRate:   20.0 / 60.0,
+		MaxChats:    10000,
+	}
+}
+
+// Wait implements Limiter interface
+func (rl *RateLimiter) Wait(ctx context.Context, method string, chatID string) error {
+	if !rl.Methods[method] {
+		return nil
+	}
+
+	rl.mu.Lock()
+	if rl.global == nil {
+		rl.global = newBucket(rl.GlobalRate)
+		rl.chats = map[string]*bucket{}
+		rl.waiting = map[string]int{}
+	}
+	now := time.Now()
+	rl.sweep(now)
+
+	d := rl.global.reserve(now)
+	chat := rl.chats[chatID]
+	if chatID != "" {
+		if chat == nil {
+			chat = newBucket(rl.chatRate(chatID))
+			rl.chats[chatID] = chat
+		}
+		if cd := chat.reserve(now); cd > d {
+			d = cd
+		}
+	}
+	if d <= 0 {
+		rl.mu.Unlock()
+		return nil
+	}
+	rl.waiting[chatID]++
+	rl.mu.Unlock()
+
+	err := sleepContext(ctx, d)
+
+	rl.mu.Lock()
+	rl.waiting[chatID]--
+	if rl.waiting[chatID] == 0 {
+		delete(rl.waiting, chatID)
+	}
+	if err != nil {
+		// request will not be sent, so tokens is returned back
+		rl.global.tokens++
+		if chat != nil {
+			chat.tokens++
+		}
+	}
+	rl.mu.Unlock()
+	return err
+}
+
+// Stats returns queue depth of limiter
+func (rl *RateLimiter) Stats() LimiterStats {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	stats := LimiterStats{Chats: make(map[string]int, len(rl.waiting))}
+	for chatID, n := range rl.waiting {
+		stats.Waiting += n
+		if chatID != "" {
+			stats.Chats[chatID] = n
+		}
+	}
+	return stats
+}
+
+// QueueDepth returns count of requests which waits for a send
+func (rl *RateLimiter) QueueDepth() int {
+	return rl.Stats().Waiting
+}
+
+// chatRate guesses chat type by chat id,
+// groups and channels have negative ids, or @username
+func (rl *RateLimiter) chatRate(chatID string) float64 {
+	if strings.HasPrefix(chatID, "-") || strings.HasPrefix(chatID, "@") {
+		return rl.GroupRate
+	}
+	return rl.PrivateRate
+}
+
+// sweep removes full buckets, they are same as new buckets
+func (rl *RateLimiter) sweep(now time.Time) {
+	if rl.MaxChats == 0 || len(rl.chats) < rl.MaxChats || now.Sub(rl.lastSweep) < time.Second {
+		return
+	}
+	rl.lastSweep = now
+	for chatID, b := range rl.chats {
+		if b.full(now) && rl.waiting[chatID] == 0 {
+			delete(rl.chats, chatID)
+		}
+	}
+}
+
+// bucket is token bucket with burst of one second
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{rate: rate, burst: burst, tokens: burst}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// reserve takes one token, and returns time to wait for it
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
@@ -0,0 +1,51 @@
+package tgp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterPerChat(t *testing.T) {
+	rl := NewRateLimiter()
+	rl.PrivateRate = 10
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 12; i++ {
+		if err := rl.Wait(ctx, "sendMessage", "1000"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) < 150*time.Millisecond {
+		t.Fatal("requests to one chat is not throttled")
+	}
+
+	start = time.Now()
+	rl.Wait(ctx, "sendMessage", "1001")
+	rl.Wait(ctx, "getMe", "1000")
+	if time.Since(start) > 50*time.Millisecond {
+		t.Fatal("other chat, or not send method is throttled")
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	rl := NewRateLimiter()
+	rl.Wait(context.Background(), "sendMessage", "-1000")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- rl.Wait(ctx, "sendMessage", "-1000") }()
+
+	time.Sleep(20 * time.Millisecond)
+	if n := rl.QueueDepth(); n != 1 {
+		t.Fatal("wrong queue depth", n)
+	}
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("wait is not cancelled")
+	}
+	if n := rl.QueueDepth(); n != 0 {
+		t.Fatal("wrong queue depth after cancel", n)
+	}
+}
@@ -0,0 +1,129 @@
+package tgp
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/pikoUsername/tgp/objects"
+)
+
+// RetryPolicy describes how Bot retries failed requests.
+// On flood control error(429) request will be retried after retry_after seconds,
+// on 5xx and network errors backoff grows exponentially
+//
+// Bot.Retry is nil by default, so requests is not retried
+type RetryPolicy struct {
+	// MaxAttempts is count of attempts, including first one
+	MaxAttempts int
+
+	// BaseDelay is delay before second attempt, every next attempt doubles it
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// MaxRetryAfter is upper bound for retry_after, if telegram
+	// asks to wait longer, error returns instantly. Zero means no bound
+	MaxRetryAfter time.Duration
+
+	// SkipMethods is methods which will never be retried,
+	// for example methods that are not safe to repeat
+	SkipMethods map[string]bool
+}
+
+// NewRetryPolicy returns policy filled by default values,
+// BaseDelay is 0.5 second and MaxDelay is 30 seconds
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		SkipMethods: map[string]bool{},
+	}
+}
+
+// Skip disables retries for methods
+func (rp *RetryPolicy) Skip(methods ...string) *RetryPolicy {
+	if rp.SkipMethods == nil {
+		rp.SkipMethods = map[string]bool{}
+	}
+	for _, m := range methods {
+		rp.SkipMethods[m] = true
+	}
+	return rp
+}
+
+// delay returns time to wait before next attempt,
+// false means that err can not be retried
+func (rp *RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	var apiErr *objects.TelegramApiError
+	if errors.As(err, &apiErr) {
+		if apiErr.RetryAfter > 0 {
+			d := time.Duration(apiErr.RetryAfter) * time.Second
+			if rp.MaxRetryAfter != 0 && d > rp.MaxRetryAfter {
+				return 0, false
+			}
+			return d, true
+		}
+		if apiErr.Code < 500 {
+			return 0, false
+		}
+		return rp.backoff(attempt), true
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		return rp.backoff(attempt), true
+	}
+	return 0, false
+}
+
+func (rp *RetryPolicy) backoff(attempt int) time.Duration {
+	d := rp.BaseDelay
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if rp.MaxDelay != 0 && d >= rp.MaxDelay {
+			return rp.MaxDelay
+		}
+	}
+	return d
+}
+
+// retry calls do until it succeeds, or policy allows it
+// if rewindable is false, request will be made only once
+func (bot *Bot) retry(ctx context.Context, method string, rewindable bool, do func() (*objects.TelegramResponse, error)) (*objects.TelegramResponse, error) {
+	rp := bot.Retry
+	if rp == nil || !rewindable || rp.SkipMethods[method] {
+		return do()
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := do()
+		if err == nil || attempt >= rp.MaxAttempts {
+			return resp, err
+		}
+		d, ok := rp.delay(attempt, err)
+		if !ok {
+			return resp, err
+		}
+		if serr := sleepContext(ctx, d); serr != nil {
+			return resp, err
+		}
+	}
+}
+
+// sleepContext sleeps d, or returns error when ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
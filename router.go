@@ -0,0 +1,173 @@
+package tgp
+
+import (
+	"github.com/pikoUsername/tgp/objects"
+)
+
+var ErrorRouterIncluded = tgpErr.New("router is already included to another router")
+
+// Router is set of handler chains with own filters and middlewares,
+// routers can be included to another router, or dispatcher,
+// so big bot can be splitted to feature packages
+//
+// ```
+// admin := tgp.NewRouter("admin")
+// admin.Filters(isAdmin)
+// admin.MessageHandler.HandlerFunc(ban).Command("ban")
+// dp.IncludeRouter(admin)
+// ```
+// Update is propagated depth-first, own handlers of router is checked first,
+// after that included routers in order of including, until one handles update
+type Router struct {
+	Name string
+
+	// handlers
+	*AllHandlerTypes
+
+	filters     []Filter
+	middlewares []MiddlewareFunc
+	outer       []MiddlewareFunc
+	parent      *Router
+	children    []*Router
+
+	// scene returns router of active scene, which gets update
+	// before handlers of router, uses by dispatcher
+	scene func(*Context) *Router
+}
+
+// NewRouter returns router with empty handler chains
+func NewRouter(name string) *Router {
+	return &Router{
+		Name:            name,
+		AllHandlerTypes: newHandlerTypes(),
+	}
+}
+
+// Filters registers router filters, if one of them is not passed,
+// handlers of router and included routers will be skipped
+func (r *Router) Filters(filters ...Filter) *Router {
+	r.filters = append(r.filters, filters...)
+	return r
+}
+
+// Use registers inner middlewares, which wraps matched handlers of router,
+// and handlers of included routers
+func (r *Router) Use(md ...MiddlewareFunc) *Router {
+	r.middlewares = append(r.middlewares, md...)
+	return r
+}
+
+// UseOuter registers outer middlewares, which are called for every update,
+// which reaches router, before router filters.
+// If middleware does not call next, update is not propagated deeper
+func (r *Router) UseOuter(md ...MiddlewareFunc) *Router {
+	r.outer = append(r.outer, md...)
+	return r
+}
+
+// IncludeRouter includes routers as children,
+// router can be included only once, otherwise it panics
+func (r *Router) IncludeRouter(routers ...*Router) *Router {
+	for _, child := range routers {
+		if child.parent != nil {
+			panic(ErrorRouterIncluded)
+		}
+		for p := r; p != nil; p = p.parent {
+			if p == child {
+				panic(tgpErr.New("router " + child.Name + " can not include itself"))
+			}
+		}
+		child.parent = r
+		r.children = append(r.children, child)
+	}
+	return r
+}
+
+// Routers returns included routers
+func (r *Router) Routers() []*Router {
+	return r.children
+}
+
+// Parent returns router, which includes this one
+func (r *Router) Parent() *Router {
+	return r.parent
+}
+
+// propagate calls outer middlewares, and triggers handlers of router,
+// and included routers, returns true if update is handled
+func (r *Router) propagate(c *Context) bool {
+	if len(r.outer) == 0 {
+		return r.propagateInner(c)
+	}
+
+	var handled bool
+	wrapMiddlewares(func(c *Context) {
+		handled = r.propagateInner(c)
+	}, r.outer)(c)
+	return handled
+}
+
+func (r *Router) propagateInner(c *Context) bool {
+	if len(r.filters) > 0 && !checkFilters(r.filters, c) {
+		return false
+	}
+
+	middlewares := c.middlewares
+	c.middlewares = append(middlewares[:len(middlewares):len(middlewares)], r.middlewares...)
+	defer func() { c.middlewares = middlewares }()
+
+	if r.scene != nil {
+		if scene := r.scene(c); scene != nil && scene.propagate(c) {
+			return true
+		}
+	}
+	if chain := r.chainFor(c.Update); chain != nil {
+		c.handled = false
+		chain.Trigger(c)
+		if c.handled {
+			return true
+		}
+	}
+	for _, child := range r.children {
+		if child.propagate(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// chainFor returns handler chain for type of update,
+// nil if update type is not supported
+func (ht *AllHandlerTypes) chainFor(upd *objects.Update) HandlerChain {
+	switch {
+	case upd.Message != nil:
+		return ht.MessageHandler
+	case upd.EditedMessage != nil:
+		return ht.EditedMessageHandler
+	case upd.CallbackQuery != nil:
+		return ht.CallbackQueryHandler
+	case upd.ChannelPost != nil:
+		return ht.ChannelPostHandler
+	case upd.EditedChannelPost != nil:
+		return ht.EditedChannelPostHandler
+	case upd.Poll != nil:
+		return ht.PollHandler
+	case upd.PollAnswer != nil:
+		return ht.PollAnswerHandler
+	case upd.ChatMember != nil:
+		return ht.ChatMemberHandler
+	case upd.MyChatMember != nil:
+		return ht.MyChatMemberHandler
+	case upd.ChatJoinRequest != nil:
+		return ht.ChatJoinRequestHandler
+	case upd.InlineQuery != nil:
+		return ht.InlineQueryHandler
+	case upd.ChosenInlineResult != nil:
+		return ht.ChosenInlineResultHandler
+	case upd.ShippingQuery != nil:
+		return ht.ShippingQueryHandler
+	case upd.PreCheckoutQuery != nil:
+		return ht.PreCheckoutQueryHandler
+	}
+	return nil
+}
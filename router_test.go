@@ -0,0 +1,102 @@
+package tgp
+
+import (
+	"testing"
+
+	"github.com/pikoUsername/tgp/objects"
+)
+
+type chatFilter int64
+
+func (cf chatFilter) Check(u *objects.Update) bool {
+	return u.Message != nil && u.Message.Chat.ID == int64(cf)
+}
+
+func TestRouterPropagation(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var called []string
+
+	admin := NewRouter("admin")
+	admin.Filters(chatFilter(1))
+	admin.MessageHandler.HandlerFunc(func(ctx *Context) {
+		called = append(called, "admin")
+	}).Command("ban")
+
+	shop := NewRouter("shop")
+	shop.MessageHandler.HandlerFunc(func(ctx *Context) {
+		called = append(called, "shop")
+	}).Command("buy")
+
+	nested := NewRouter("nested")
+	nested.MessageHandler.HandlerFunc(func(ctx *Context) {
+		called = append(called, "nested")
+	})
+	shop.IncludeRouter(nested)
+	dp.IncludeRouter(admin, shop)
+
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		called = append(called, "dp")
+	}).Command("start")
+
+	for _, upd := range []*objects.Update{
+		messageUpdate(0, 2, "/start"),
+		messageUpdate(0, 1, "/ban"),
+		messageUpdate(0, 2, "/ban"), // filtered by admin router
+		messageUpdate(0, 2, "/buy"),
+	} {
+		if err := dp.ProcessOneUpdate(upd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"dp", "admin", "nested", "shop"}
+	if len(called) != len(expected) {
+		t.Fatal("wrong handlers called", called)
+	}
+	for i := range expected {
+		if called[i] != expected[i] {
+			t.Fatal("wrong handlers called", called)
+		}
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	mw := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) {
+				order = append(order, name)
+				next(ctx)
+			}
+		}
+	}
+
+	r := NewRouter("child")
+	r.Use(mw("child"))
+	r.MessageHandler.HandlerFunc(func(ctx *Context) {
+		order = append(order, "handler")
+	})
+	dp.Use(mw("root"))
+	dp.IncludeRouter(r)
+
+	if err := dp.ProcessOneUpdate(messageUpdate(0, 1, "hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "root" || order[1] != "child" || order[2] != "handler" {
+		t.Fatal("wrong middleware order", order)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("router included twice")
+		}
+	}()
+	dp.IncludeRouter(r)
+}
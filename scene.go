@@ -0,0 +1,281 @@
+package tgp
+
+import (
+	"github.com/pikoUsername/tgp/fsm/storage"
+)
+
+// sceneStackKey is key of stored FSM data, which keeps scene stack,
+// it is hidden from Context.GetData, and is kept by Context.SetData
+const sceneStackKey = "@scenes"
+
+var (
+	ErrorSceneNotFound = tgpErr.New("scene is not registered")
+	ErrorNoActiveScene = tgpErr.New("there is no active scene")
+)
+
+// Scene is multi-step flow, e.g registration, with own handlers,
+// enter and leave hooks, and data. Scenes are entered by Context.EnterScene
+//
+// ```
+// reg := tgp.NewScene("registration")
+// reg.OnEnter(func(ctx *tgp.Context) {
+//     ctx.Reply(tgp.NewReplyMessage("What is your name?"))
+// })
+// reg.MessageHandler.HandlerFunc(func(ctx *tgp.Context) {
+//     ctx.SetSceneData(storage.PackType{"name": ctx.Message.Text})
+//     ctx.LeaveScene()
+// })
+// dp.RegisterScene(reg)
+// ```
+// While scene is active, update goes to handlers of scene first,
+// if no one handles it, update goes to routers of dispatcher.
+// Scenes are kept in stack, so one scene can enter another one,
+// and LeaveScene returns to caller scene
+type Scene struct {
+	// handlers of scene
+	*Router
+
+	onEnter []HandlerFunc
+	onLeave []HandlerFunc
+}
+
+// NewScene returns scene with empty handler chains
+func NewScene(name string) *Scene {
+	return &Scene{Router: NewRouter(name)}
+}
+
+// OnEnter registers hooks, which are called after scene is entered
+func (s *Scene) OnEnter(h ...HandlerFunc) *Scene {
+	s.onEnter = append(s.onEnter, h...)
+	return s
+}
+
+// OnLeave registers hooks, which are called before scene is left,
+// so scene data is still available
+func (s *Scene) OnLeave(h ...HandlerFunc) *Scene {
+	s.onLeave = append(s.onLeave, h...)
+	return s
+}
+
+// RegisterScene registers scenes, which can be entered by Context.EnterScene
+// scene with same name is replaced
+func (dp *Dispatcher) RegisterScene(scenes ...*Scene) {
+	for _, s := range scenes {
+		dp.scenes[s.Name] = s
+	}
+}
+
+// activeScene returns router of current scene, uses by root router
+func (dp *Dispatcher) activeScene(c *Context) *Router {
+	if len(dp.scenes) == 0 {
+		return nil
+	}
+	scene, err := c.CurrentScene()
+	if err == ErrorNoStorageKey {
+		// e.g poll updates, they can not be in scene
+		return nil
+	}
+	if err != nil {
+		c.AbortWithError(err)
+		return nil
+	}
+	if scene == nil {
+		return nil
+	}
+	return scene.Router
+}
+
+// sceneFrame is element of scene stack
+type sceneFrame struct {
+	name string
+	data storage.PackType
+}
+
+// sceneStack loads scene stack from stored FSM data, top of stack is last
+func (ctx *Context) sceneStack() (storage.PackType, []sceneFrame, error) {
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ctx.Storage.GetData(cid, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, _ := data[sceneStackKey].([]interface{})
+	stack := make([]sceneFrame, 0, len(raw))
+	for _, r := range raw {
+		m := toPack(r)
+		name, _ := m["name"].(string)
+		stack = append(stack, sceneFrame{name: name, data: toPack(m["data"])})
+	}
+	return data, stack, nil
+}
+
+// saveSceneStack saves scene stack to stored FSM data, other keys of data are kept
+func (ctx *Context) saveSceneStack(data storage.PackType, stack []sceneFrame) error {
+	cid, uid, err := ctx.storageKey()
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = storage.PackType{}
+	}
+	if len(stack) == 0 {
+		delete(data, sceneStackKey)
+	} else {
+		raw := make([]interface{}, len(stack))
+		for i, f := range stack {
+			raw[i] = map[string]interface{}{"name": f.name, "data": map[string]interface{}(f.data)}
+		}
+		data[sceneStackKey] = raw
+	}
+	return ctx.Storage.SetData(cid, uid, data)
+}
+
+// withoutSceneStack returns copy of data without scene stack,
+// nil if there is nothing else in data
+func withoutSceneStack(data storage.PackType) storage.PackType {
+	if _, ok := data[sceneStackKey]; !ok {
+		return data
+	}
+	if len(data) == 1 {
+		return nil
+	}
+	clean := make(storage.PackType, len(data)-1)
+	for k, v := range data {
+		if k != sceneStackKey {
+			clean[k] = v
+		}
+	}
+	return clean
+}
+
+// withSceneStack returns copy of data with scene stack
+func withSceneStack(data storage.PackType, stack interface{}) storage.PackType {
+	full := make(storage.PackType, len(data)+1)
+	for k, v := range data {
+		full[k] = v
+	}
+	full[sceneStackKey] = stack
+	return full
+}
+
+// deepCopy returns copy of value of decoded json,
+// nested objects and arrays are copied too
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case storage.PackType:
+		return map[string]interface{}(copyPackDeep(v))
+	case map[string]interface{}:
+		return map[string]interface{}(copyPackDeep(v))
+	case []interface{}:
+		cp := make([]interface{}, len(v))
+		for i, e := range v {
+			cp[i] = deepCopy(e)
+		}
+		return cp
+	}
+	return v
+}
+
+// copyPackDeep returns copy of data with copied nested objects and arrays
+func copyPackDeep(data storage.PackType) storage.PackType {
+	if data == nil {
+		return nil
+	}
+	cp := make(storage.PackType, len(data))
+	for k, v := range data {
+		cp[k] = deepCopy(v)
+	}
+	return cp
+}
+
+// toPack converts value of decoded json object to PackType,
+// returns empty PackType for other types
+func toPack(v interface{}) storage.PackType {
+	switch m := v.(type) {
+	case storage.PackType:
+		return m
+	case map[string]interface{}:
+		return storage.PackType(m)
+	}
+	return storage.PackType{}
+}
+
+// EnterScene pushes scene to scene stack, and calls enter hooks of scene
+func (ctx *Context) EnterScene(name string) error {
+	scene, ok := ctx.scenes[name]
+	if !ok {
+		return ErrorSceneNotFound
+	}
+	data, stack, err := ctx.sceneStack()
+	if err != nil {
+		return err
+	}
+	stack = append(stack, sceneFrame{name: name, data: storage.PackType{}})
+	if err := ctx.saveSceneStack(data, stack); err != nil {
+		return err
+	}
+
+	for _, h := range scene.onEnter {
+		h(ctx)
+	}
+	return nil
+}
+
+// LeaveScene calls leave hooks of current scene, and pops it from scene stack,
+// after that previous scene becomes active, its enter hooks are not called
+func (ctx *Context) LeaveScene() error {
+	scene, err := ctx.CurrentScene()
+	if err != nil {
+		return err
+	}
+	if scene == nil {
+		return ErrorNoActiveScene
+	}
+	for _, h := range scene.onLeave {
+		h(ctx)
+	}
+
+	data, stack, err := ctx.sceneStack()
+	if err != nil || len(stack) == 0 {
+		return err
+	}
+	return ctx.saveSceneStack(data, stack[:len(stack)-1])
+}
+
+// CurrentScene returns active scene, nil if there is no one
+// not registered scenes are ignored
+func (ctx *Context) CurrentScene() (*Scene, error) {
+	_, stack, err := ctx.sceneStack()
+	if err != nil || len(stack) == 0 {
+		return nil, err
+	}
+	return ctx.scenes[stack[len(stack)-1].name], nil
+}
+
+// SceneData returns data of current scene
+func (ctx *Context) SceneData() (storage.PackType, error) {
+	_, stack, err := ctx.sceneStack()
+	if err != nil {
+		return nil, err
+	}
+	if len(stack) == 0 {
+		return nil, ErrorNoActiveScene
+	}
+	return copyPackDeep(stack[len(stack)-1].data), nil
+}
+
+// SetSceneData replaces data of current scene, data is copied
+func (ctx *Context) SetSceneData(sceneData storage.PackType) error {
+	data, stack, err := ctx.sceneStack()
+	if err != nil {
+		return err
+	}
+	if len(stack) == 0 {
+		return ErrorNoActiveScene
+	}
+	stack[len(stack)-1].data = copyPackDeep(sceneData)
+	return ctx.saveSceneStack(data, stack)
+}
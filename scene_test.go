@@ -0,0 +1,135 @@
+package tgp
+
+import (
+	"testing"
+
+	"github.com/pikoUsername/tgp/fsm/storage"
+)
+
+func TestScenes(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+
+	address := NewScene("address")
+	address.OnEnter(func(ctx *Context) {
+		calls = append(calls, "enter address")
+	})
+	address.MessageHandler.HandlerFunc(func(ctx *Context) {
+		calls = append(calls, "address")
+		ctx.LeaveScene()
+	})
+
+	reg := NewScene("registration")
+	reg.OnLeave(func(ctx *Context) {
+		data, _ := ctx.SceneData()
+		calls = append(calls, "leave "+data["name"].(string))
+	})
+	reg.MessageHandler.HandlerFunc(func(ctx *Context) {
+		calls = append(calls, "address command")
+		ctx.EnterScene("address")
+	}).Command("address")
+	reg.MessageHandler.HandlerFunc(func(ctx *Context) {
+		calls = append(calls, "name")
+		ctx.SetSceneData(storage.PackType{"name": ctx.Message.Text})
+		ctx.LeaveScene()
+	})
+	dp.RegisterScene(reg, address)
+
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		calls = append(calls, "start")
+		ctx.EnterScene("registration")
+	}).Command("start")
+	dp.MessageHandler.HandlerFunc(func(ctx *Context) {
+		calls = append(calls, "default")
+	})
+
+	for _, text := range []string{"/start", "/address", "street", "piko", "hi"} {
+		if err := dp.ProcessOneUpdate(messageUpdate(0, 1, text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{
+		"start", "address command", "enter address", "address",
+		"name", "leave piko", "default",
+	}
+	if len(calls) != len(expected) {
+		t.Fatal("wrong calls", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatal("wrong calls", calls)
+		}
+	}
+}
+
+func TestEnterNotRegisteredScene(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := dp.Context(messageUpdate(0, 1, "hi"))
+	if err := ctx.EnterScene("unknown"); err != ErrorSceneNotFound {
+		t.Fatal("wrong error", err)
+	}
+	if err := ctx.LeaveScene(); err != ErrorNoActiveScene {
+		t.Fatal("wrong error", err)
+	}
+}
+
+func TestSceneStackIsolated(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.RegisterScene(NewScene("registration"))
+	ctx := dp.Context(messageUpdate(0, 1, "hi"))
+
+	ctx.SetData(storage.PackType{"name": "piko"})
+	if err := ctx.EnterScene("registration"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ctx.GetData()
+	if _, ok := data[sceneStackKey]; ok || data["name"] != "piko" {
+		t.Fatal("scene stack is returned with data", data)
+	}
+
+	ctx.SetData(storage.PackType{"age": 17})
+	if scene, _ := ctx.CurrentScene(); scene == nil {
+		t.Fatal("scene is left after SetData")
+	}
+	ctx.ClearState()
+	if scene, _ := ctx.CurrentScene(); scene != nil {
+		t.Fatal("scene is not left after ClearState")
+	}
+	if data, _ := ctx.GetData(); data != nil {
+		t.Fatal("data is not cleared", data)
+	}
+}
+
+func TestSceneDataCopy(t *testing.T) {
+	dp, err := GetDispatcher(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.RegisterScene(NewScene("registration"))
+	ctx := dp.Context(messageUpdate(0, 1, "hi"))
+	ctx.EnterScene("registration")
+
+	sceneData := storage.PackType{"address": map[string]interface{}{"city": "Almaty"}}
+	ctx.SetSceneData(sceneData)
+	sceneData["address"].(map[string]interface{})["city"] = "changed"
+
+	data, _ := ctx.SceneData()
+	address := data["address"].(map[string]interface{})
+	if address["city"] != "Almaty" {
+		t.Fatal("stored scene data is changed by caller", data)
+	}
+	address["city"] = "changed"
+	if data, _ := ctx.SceneData(); data["address"].(map[string]interface{})["city"] != "Almaty" {
+		t.Fatal("stored scene data is changed by returned map", data)
+	}
+}
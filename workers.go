@@ -0,0 +1,220 @@
+package tgp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pikoUsername/tgp/objects"
+)
+
+const (
+	// DefaultMaxConcurrency is count of workers, which process updates
+	DefaultMaxConcurrency = 10
+	// DefaultQueueSize is size of every worker queue
+	DefaultQueueSize = 100
+)
+
+var ErrorPoolClosed = tgpErr.New("worker pool is closed")
+
+// WorkerPool processes updates by fixed count of workers,
+// every worker has own bounded queue. Updates from same chat (or user,
+// if update has not chat) always go to same worker, so they are processed
+// in order, while updates from different chats are processed in parallel
+type WorkerPool struct {
+	queues []chan *objects.Update
+	handle func(*objects.Update)
+
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+	// done is closed by Close, before it waits for blocked Submit calls
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWorkerPool starts workers, zero values replaced by defaults
+// Submit blocks, when queue of worker is full
+func NewWorkerPool(workers, queueSize int, handle func(*objects.Update)) *WorkerPool {
+	if workers <= 0 {
+		workers = DefaultMaxConcurrency
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	wp := &WorkerPool{
+		queues: make([]chan *objects.Update, workers),
+		handle: handle,
+		done:   make(chan struct{}),
+	}
+	for i := range wp.queues {
+		q := make(chan *objects.Update, queueSize)
+		wp.queues[i] = q
+		wp.wg.Add(1)
+		go wp.work(q)
+	}
+	return wp
+}
+
+func (wp *WorkerPool) work(q <-chan *objects.Update) {
+	defer wp.wg.Done()
+	for upd := range q {
+		wp.handle(upd)
+	}
+}
+
+// Submit puts update to queue of worker,
+// returns error if ctx is done, or pool is closed before queue has free space
+func (wp *WorkerPool) Submit(ctx context.Context, upd *objects.Update) error {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	if wp.closed {
+		return ErrorPoolClosed
+	}
+	q := wp.queues[updateKey(upd)%uint64(len(wp.queues))]
+
+	select {
+	case q <- upd:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wp.done:
+		return ErrorPoolClosed
+	}
+}
+
+// Close stops accepting of new updates,
+// already queued updates still will be processed
+func (wp *WorkerPool) Close() {
+	// Submit holds read lock, while it waits for free space in queue
+	wp.closeOnce.Do(func() { close(wp.done) })
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	if wp.closed {
+		return
+	}
+	wp.closed = true
+	for _, q := range wp.queues {
+		close(q)
+	}
+}
+
+// Wait waits until workers process all queued updates, or ctx is done
+// Close must be called before, otherwise Wait returns only by ctx
+func (wp *WorkerPool) Wait(ctx context.Context) error {
+	return waitContext(ctx, &wp.wg)
+}
+
+// waitContext waits wg, or returns error when ctx is done
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// updateKey returns chat id of update, or user id if update has not chat,
+// poll updates are keyed by poll id.
+// updates without all of them are distributed by update id
+func updateKey(upd *objects.Update) uint64 {
+	var msg *objects.Message
+	var chat *objects.Chat
+	var user *objects.User
+
+	switch {
+	case upd.Message != nil:
+		msg = upd.Message
+	case upd.EditedMessage != nil:
+		msg = upd.EditedMessage
+	case upd.ChannelPost != nil:
+		msg = upd.ChannelPost
+	case upd.EditedChannelPost != nil:
+		msg = upd.EditedChannelPost
+	case upd.CallbackQuery != nil:
+		msg = upd.CallbackQuery.Message
+		user = upd.CallbackQuery.From
+	case upd.InlineQuery != nil:
+		user = upd.InlineQuery.From
+	case upd.ChosenInlineResult != nil:
+		user = upd.ChosenInlineResult.From
+	case upd.ShippingQuery != nil:
+		user = upd.ShippingQuery.From
+	case upd.PreCheckoutQuery != nil:
+		user = upd.PreCheckoutQuery.From
+	case upd.Poll != nil:
+		return uint64(upd.Poll.ID)
+	case upd.PollAnswer != nil:
+		user = upd.PollAnswer.User
+	case upd.MyChatMember != nil:
+		chat = upd.MyChatMember.Chat
+		user = upd.MyChatMember.From
+	case upd.ChatMember != nil:
+		chat = upd.ChatMember.Chat
+		user = upd.ChatMember.From
+	case upd.ChatJoinRequest != nil:
+		chat = upd.ChatJoinRequest.Chat
+		user = upd.ChatJoinRequest.From
+	}
+
+	if msg != nil {
+		chat = msg.Chat
+	}
+	if chat != nil {
+		return uint64(chat.ID)
+	}
+	if user != nil {
+		return uint64(user.ID)
+	}
+	return uint64(upd.UpdateID)
+}
+
+// keyMutex is set of mutexes by storage key, zero value is ready to use
+type keyMutex struct {
+	mu    sync.Mutex
+	locks map[[2]int64]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	// count of goroutines, which hold, or wait for lock
+	refs int
+}
+
+// Lock locks mutex of key, and returns function, which unlocks it
+// mutex is removed, when nobody uses it
+func (km *keyMutex) Lock(cid, uid int64) func() {
+	key := [2]int64{cid, uid}
+	km.mu.Lock()
+	if km.locks == nil {
+		km.locks = make(map[[2]int64]*keyLock)
+	}
+	l, ok := km.locks[key]
+	if !ok {
+		l = &keyLock{}
+		km.locks[key] = l
+	}
+	l.refs++
+	km.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		km.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
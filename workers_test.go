@@ -0,0 +1,131 @@
+package tgp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pikoUsername/tgp/objects"
+)
+
+func TestWorkerPoolOrder(t *testing.T) {
+	var mu sync.Mutex
+	var got []int64
+	pool := NewWorkerPool(4, 1, func(upd *objects.Update) {
+		mu.Lock()
+		got = append(got, upd.UpdateID)
+		mu.Unlock()
+	})
+
+	for i := int64(0); i < 100; i++ {
+		if err := pool.Submit(context.Background(), messageUpdate(i, 42, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool.Close()
+	if err := pool.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 100 {
+		t.Fatal("not all updates processed", len(got))
+	}
+	for i, id := range got {
+		if id != int64(i) {
+			t.Fatal("updates of one chat processed out of order", got)
+		}
+	}
+	if err := pool.Submit(context.Background(), messageUpdate(100, 42, "")); err != ErrorPoolClosed {
+		t.Fatal("submit to closed pool", err)
+	}
+}
+
+func TestWorkerPoolParallel(t *testing.T) {
+	block := make(chan struct{})
+	done := make(chan int64, 10)
+	pool := NewWorkerPool(2, 1, func(upd *objects.Update) {
+		if upd.Message.Chat.ID == 1 {
+			<-block
+		}
+		done <- upd.Message.Chat.ID
+	})
+	defer pool.Close()
+	defer close(block)
+
+	pool.Submit(context.Background(), messageUpdate(1, 1, ""))
+	pool.Submit(context.Background(), messageUpdate(2, 2, ""))
+
+	select {
+	case id := <-done:
+		if id != 2 {
+			t.Fatal("wrong chat processed", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked chat blocks other chats")
+	}
+
+	// queue of blocked worker is full, so submit waits until ctx is done
+	pool.Submit(context.Background(), messageUpdate(3, 1, ""))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Submit(ctx, messageUpdate(4, 1, "")); err != context.DeadlineExceeded {
+		t.Fatal("submit to full queue", err)
+	}
+}
+
+func TestWorkerPoolCloseBlockedSubmit(t *testing.T) {
+	block := make(chan struct{})
+	pool := NewWorkerPool(1, 1, func(upd *objects.Update) {
+		<-block
+	})
+	defer close(block)
+
+	// first update blocks worker, second fills queue
+	pool.Submit(context.Background(), messageUpdate(1, 1, ""))
+	pool.Submit(context.Background(), messageUpdate(2, 1, ""))
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- pool.Submit(context.Background(), messageUpdate(3, 1, ""))
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close is blocked by waiting submit")
+	}
+	if err := <-submitted; err != ErrorPoolClosed {
+		t.Fatal("wrong error of waiting submit", err)
+	}
+}
+
+func TestUpdateKey(t *testing.T) {
+	chat := &objects.Chat{ID: 42}
+	user := &objects.User{ID: 7}
+	cases := []struct {
+		name string
+		u    *objects.Update
+		key  uint64
+	}{
+		{"message", messageUpdate(1, 42, ""), 42},
+		{"callback query", &objects.Update{CallbackQuery: &objects.CallbackQuery{From: user, Message: &objects.Message{Chat: chat}}}, 42},
+		{"inline callback query", &objects.Update{CallbackQuery: &objects.CallbackQuery{From: user}}, 7},
+		{"my chat member", &objects.Update{MyChatMember: &objects.ChatMemberUpdated{Chat: chat, From: user}}, 42},
+		{"chat member", &objects.Update{ChatMember: &objects.ChatMemberUpdated{Chat: chat, From: user}}, 42},
+		{"join request", &objects.Update{ChatJoinRequest: &objects.ChatJoinRequest{Chat: chat, From: user}}, 42},
+		{"poll", &objects.Update{UpdateID: 1, Poll: &objects.Poll{ID: 9}}, 9},
+		{"poll answer", &objects.Update{PollAnswer: &objects.PollAnswer{User: user}}, 7},
+		{"unknown", &objects.Update{UpdateID: 3}, 3},
+	}
+	for _, c := range cases {
+		if key := updateKey(c.u); key != c.key {
+			t.Errorf("%s: got %d", c.name, key)
+		}
+	}
+}